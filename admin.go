@@ -0,0 +1,125 @@
+package main
+
+import (
+	"PWBSS2019/protocol"
+	"encoding/xml"
+	"fmt"
+	"github.com/pborman/getopt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+)
+
+func adminMain(args []string) error {
+	set := getopt.New()
+	host := set.StringLong("host", 'h', "localhost", "server host")
+	port := set.IntLong("port", 'p', 13050, "server port")
+	password := set.StringLong("password", 'a', "", "administrator password of the server")
+	first := set.StringLong("first", '1', "Player 1", "display name of the first (red) player")
+	second := set.StringLong("second", '2', "Player 2", "display name of the second (blue) player")
+	games := set.IntLong("games", 'n', 1, "number of games to prepare")
+	launch := set.BoolLong("launch", 'l', "start two local clients for every prepared game")
+	set.SetParameters("[-- client-args...]")
+	set.Parse(args)
+
+	address := net.JoinHostPort(*host, strconv.Itoa(*port))
+	con, err := net.Dial("tcp", address)
+	if err != nil {
+		return fmt.Errorf("could not connect to server %s: %v", address, err)
+	}
+	defer con.Close()
+
+	_, err = fmt.Fprintf(con, "<protocol><authenticate passphrase=\"%s\"/>", xmlEscape(*password))
+	if err != nil {
+		return fmt.Errorf("could not authenticate: %v", err)
+	}
+
+	d := xml.NewDecoder(con)
+	var prepared []*protocol.PreparedMessage
+	for i := 0; i < *games; i++ {
+		p, err := prepare(con, d, *first, *second)
+		if err != nil {
+			return fmt.Errorf("could not prepare game: %v", err)
+		}
+		fmt.Printf("room %s: %s %s\n", p.RoomID, p.Reservations[0], p.Reservations[1])
+		prepared = append(prepared, p)
+	}
+
+	if *launch {
+		return launchClients(prepared, *host, *port, set.Args())
+	}
+	return nil
+}
+
+func prepare(w io.Writer, d *xml.Decoder, first string, second string) (*protocol.PreparedMessage, error) {
+	request := &protocol.PrepareMessage{GameType: protocol.GameType, Slots: []protocol.SlotMessage{
+		{DisplayName: first, CanTimeout: true},
+		{DisplayName: second, CanTimeout: true},
+	}}
+	data, err := xml.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+
+	for {
+		v, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		t, ok := v.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch t.Name.Local {
+		case "prepared":
+			prepared := new(protocol.PreparedMessage)
+			if err := d.DecodeElement(prepared, &t); err != nil {
+				return nil, err
+			}
+			if len(prepared.Reservations) != 2 {
+				return nil, fmt.Errorf("expected 2 reservation codes, got %d", len(prepared.Reservations))
+			}
+			return prepared, nil
+		case "error":
+			return nil, fmt.Errorf("server error: %s", attrValue(t, "message"))
+		}
+	}
+}
+
+// launchClients starts this binary once per reservation code and waits for
+// all clients to finish. When a client cannot be started, the clients
+// started before are still waited for.
+func launchClients(prepared []*protocol.PreparedMessage, host string, port int, clientArgs []string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("could not find client executable: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for _, p := range prepared {
+		for _, code := range p.Reservations {
+			args := append([]string{"--host", host, "--port", strconv.Itoa(port), "--reservation", code}, clientArgs...)
+			cmd := exec.Command(executable, args...)
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			if err := cmd.Start(); err != nil {
+				return fmt.Errorf("could not start client: %v", err)
+			}
+			wg.Add(1)
+			go func(roomID string) {
+				defer wg.Done()
+				if err := cmd.Wait(); err != nil {
+					fmt.Fprintf(os.Stderr, "client in room %s failed: %v\n", roomID, err)
+				}
+			}(p.RoomID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"PWBSS2019/gamelogic"
+	"context"
+	"fmt"
+	"github.com/pborman/getopt"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// arenaMain plays the engine with the given search options against the
+// engine without late move reductions and futility pruning. Every start
+// position is played twice with swapped colors.
+func arenaMain(args []string) error {
+	set := getopt.New()
+	games := set.IntLong("games", 'n', 10, "number of games, rounded up to an even number")
+	moveTime := set.DurationLong("move-time", 0, 100*time.Millisecond, "time budget for every move")
+	depth := set.IntLong("depth", 'd', 0, "fixed search depth instead of the move time, makes the results reproducible")
+	seed := set.Int64Long("seed", 0, 1, "seed for the start positions")
+	candidate := searchOptionFlags(set)
+	set.Parse(args)
+	if *games < 1 || *depth < 0 {
+		set.PrintUsage(os.Stderr)
+		return errUsage
+	}
+
+	a := &arena{Rules: gamelogic.DefaultRules(), Candidate: *candidate, Baseline: withoutPruning(*candidate), MoveTime: *moveTime, Depth: *depth}
+	a.Played = func(game int, candidateColor gamelogic.Color, outcome string, turn int) {
+		fmt.Printf("game %d: candidate plays %s, %s after turn %d\n", game, colorName(candidateColor), outcome, turn)
+	}
+	result, err := a.play(*games, *seed)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("candidate: %d won, %d draw, %d lost, score %.1f%%, %d reductions, %d futility prunes\n",
+		result.wins, result.draws, result.losses, 100*result.score(), result.reductions, result.futilityPrunes)
+	return nil
+}
+
+// withoutPruning disables late move reductions and futility pruning.
+func withoutPruning(options gamelogic.SearchOptions) gamelogic.SearchOptions {
+	options.LMRReduction = 0
+	options.FutilityDepth = 0
+	return options
+}
+
+// arena plays the candidate search options against the baseline. Every
+// move is searched for MoveTime, or to Depth if it is set.
+type arena struct {
+	Rules     gamelogic.Rules
+	Candidate gamelogic.SearchOptions
+	Baseline  gamelogic.SearchOptions
+	MoveTime  time.Duration
+	Depth     int
+	Played    func(game int, candidateColor gamelogic.Color, outcome string, turn int)
+}
+
+// arenaResult counts the outcomes of the candidate and how often its search
+// reduced or pruned moves.
+type arenaResult struct {
+	wins           int
+	draws          int
+	losses         int
+	reductions     int
+	futilityPrunes int
+}
+
+// score is the share of points of the candidate, a draw counts half.
+func (r arenaResult) score() float64 {
+	return (float64(r.wins) + float64(r.draws)/2) / float64(r.wins+r.draws+r.losses)
+}
+
+// play plays the given number of games, rounded up to an even number, on
+// start positions generated from seed.
+func (a *arena) play(games int, seed int64) (arenaResult, error) {
+	var result arenaResult
+	r := rand.New(rand.NewSource(seed))
+	for game := 0; game < games; game += 2 {
+		board := gamelogic.NewStartBoard(r, a.Rules)
+		for _, candidateColor := range []gamelogic.Color{gamelogic.ColorRed, gamelogic.ColorBlue} {
+			var options [2]gamelogic.SearchOptions
+			options[candidateColor] = a.Candidate
+			options[candidateColor.OppositeColor()] = a.Baseline
+			game, err := a.playGame(board.Clone(), options)
+			if err != nil {
+				return result, err
+			}
+			result.reductions += game.stats[candidateColor].Reductions
+			result.futilityPrunes += game.stats[candidateColor].FutilityPrunes
+			outcome := "lost"
+			switch {
+			case game.draw:
+				result.draws++
+				outcome = "draw"
+			case game.winner == candidateColor:
+				result.wins++
+				outcome = "won"
+			default:
+				result.losses++
+			}
+			if a.Played != nil {
+				a.Played(result.wins+result.draws+result.losses, candidateColor, outcome, game.turn)
+			}
+		}
+	}
+	return result, nil
+}
+
+// arenaGame is the outcome of one game, stats are indexed by color and sum
+// the reductions and futility prunes of all searches.
+type arenaGame struct {
+	draw   bool
+	winner gamelogic.Color
+	turn   int
+	stats  [2]gamelogic.SearchStats
+}
+
+// playGame plays one game on board, options are indexed by color.
+func (a *arena) playGame(board *gamelogic.Board, options [2]gamelogic.SearchOptions) (arenaGame, error) {
+	moveLogic := gamelogic.NewMoveLogic(a.Rules)
+	var engines [2]*gamelogic.Controller
+	for color := range engines {
+		engines[color] = gamelogic.NewController(gamelogic.DefaultTranspositionMemory >> 2)
+		engines[color].SetSearchOptions(options[color])
+		engines[color].SetMaxDepth(a.Depth)
+		engines[color].SetPlayer(gamelogic.Color(color))
+	}
+
+	state := gamelogic.NewGameState(board)
+	state.Rules = a.Rules
+	state.StartColor = gamelogic.ColorRed
+	state.CurrentColor = gamelogic.ColorRed
+	var game arenaGame
+	for {
+		if over, draw, winner := moveLogic.GameOver(state); over {
+			game.draw, game.winner, game.turn = draw, winner, state.Turn
+			return game, nil
+		}
+		engine := engines[state.CurrentColor]
+		engine.UpdateState(state)
+		ctx, cancel := context.Background(), func() {}
+		if a.Depth == 0 {
+			ctx, cancel = context.WithTimeout(ctx, a.MoveTime)
+		}
+		move, _, err := engine.Evaluate(ctx)
+		cancel()
+		if err != nil {
+			return game, fmt.Errorf("turn %d: %v", state.Turn, err)
+		}
+		stats := &game.stats[state.CurrentColor]
+		stats.Reductions += engine.Stats().Reductions
+		stats.FutilityPrunes += engine.Stats().FutilityPrunes
+
+		state = moveLogic.NextState(state, move)
+	}
+}
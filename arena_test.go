@@ -0,0 +1,39 @@
+package main
+
+import (
+	"PWBSS2019/gamelogic"
+	"testing"
+)
+
+// TestArenaPruning plays the default search options against the search
+// without late move reductions and futility pruning. Both search to the same
+// fixed depth, so the results do not depend on the machine. A small board
+// keeps the games short enough at depth 3, moves are already reduced two
+// plies above the leaves to use both kinds of pruning at that depth.
+func TestArenaPruning(t *testing.T) {
+	if testing.Short() {
+		t.Skip("arena games take half a minute")
+	}
+	candidate := gamelogic.DefaultSearchOptions()
+	candidate.LMRMinDepth = 2
+	a := &arena{
+		Rules:     gamelogic.Rules{Size: 7, TurnLimit: 30, Obstacles: 1, Adjacency: gamelogic.AdjacencyDiagonal},
+		Candidate: candidate,
+		Baseline:  withoutPruning(candidate),
+		Depth:     3,
+	}
+	a.Played = func(game int, candidateColor gamelogic.Color, outcome string, turn int) {
+		t.Logf("game %d: candidate plays %s, %s after turn %d", game, colorName(candidateColor), outcome, turn)
+	}
+	result, err := a.play(6, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.reductions == 0 || result.futilityPrunes == 0 {
+		t.Fatalf("candidate made %d reductions and %d futility prunes, expected both to be used", result.reductions, result.futilityPrunes)
+	}
+	if result.score() < 0.5 {
+		t.Errorf("candidate scored %.1f%% with %d won, %d draw, %d lost, expected at least 50%%",
+			100*result.score(), result.wins, result.draws, result.losses)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"PWBSS2019/gamelogic"
+	"context"
+	"fmt"
+	"github.com/pborman/getopt"
+	"math/rand"
+	"os"
+)
+
+func benchMain(args []string) error {
+	set := getopt.New()
+	seed := set.Int64Long("seed", 0, 1, "seed for generating the positions")
+	searchPositions := set.IntLong("search-positions", 'n', 10, "number of random positions to search")
+	searchDepth := set.IntLong("search-depth", 'd', 3, "depth of the searches")
+	set.Parse(args)
+	if *searchPositions < 1 || *searchDepth < 1 {
+		set.PrintUsage(os.Stderr)
+		return errUsage
+	}
+
+	// every position is taken after a random number of turns
+	r := rand.New(rand.NewSource(*seed))
+	states := make([]*gamelogic.GameState, *searchPositions)
+	for i := range states {
+		states[i] = gamelogic.RandomState(r, gamelogic.DefaultRules(), r.Intn(60))
+	}
+	benchSearch("search (ordered):  ", states, *searchDepth, true)
+	benchSearch("search (unordered):", states, *searchDepth, false)
+	return nil
+}
+
+// benchSearch searches every state to the given depth with a fresh
+// controller and prints the summed search statistics.
+func benchSearch(name string, states []*gamelogic.GameState, depth int, ordering bool) {
+	var total gamelogic.SearchStats
+	for _, state := range states {
+		controller := gamelogic.NewController(gamelogic.DefaultTranspositionMemory >> 2)
+		controller.SetMaxDepth(depth)
+		controller.SetMoveOrdering(ordering)
+		controller.UpdateState(state)
+		controller.SetPlayer(state.CurrentColor)
+		if _, _, err := controller.Evaluate(context.Background()); err != nil {
+			continue
+		}
+		stats := controller.Stats()
+		total.Nodes += stats.Nodes
+		total.QuiescenceNodes += stats.QuiescenceNodes
+		total.Cutoffs += stats.Cutoffs
+		total.FirstMoveCutoffs += stats.FirstMoveCutoffs
+	}
+	fmt.Printf("%s %10d nodes (%d quiescence) %8d cutoffs, %.1f%% by the first move\n", name, total.Nodes, total.QuiescenceNodes, total.Cutoffs, 100*total.CutoffRate())
+}
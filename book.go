@@ -0,0 +1,156 @@
+package main
+
+import (
+	"PWBSS2019/gamelogic"
+	"PWBSS2019/protocol"
+	"PWBSS2019/replay"
+	"context"
+	"fmt"
+	"github.com/pborman/getopt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func bookMain(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: %s book build [options] [replay-dir]", os.Args[0])
+	}
+	switch args[1] {
+	case "build":
+		return bookBuild(args[1:])
+	}
+	return fmt.Errorf("unknown book command %q", args[1])
+}
+
+// bookBuild generates an opening book. Without a replay directory it plays
+// the first plies of random start positions with deep searches, every move
+// found gets weight 1. With a replay directory the book holds the moves of
+// the recorded games, weighted by the result for the moving player.
+func bookBuild(args []string) error {
+	set := getopt.New()
+	out := set.StringLong("out", 'o', "book.bin", "file to write the book to")
+	plies := set.IntLong("plies", 0, 4, "number of plies from the start position to put into the book")
+	positions := set.IntLong("positions", 'n', 50, "number of random start positions to search")
+	moveTime := set.DurationLong("move-time", 0, 10*time.Second, "time budget for the search of every position")
+	depth := set.IntLong("depth", 'd', 0, "maximum search depth, 0 searches until the move time is up")
+	seed := set.Int64Long("seed", 0, 1, "seed for the start positions")
+	set.SetParameters("[replay-dir]")
+	set.Parse(args)
+	if *plies < 1 || *positions < 1 || set.NArgs() > 1 {
+		set.PrintUsage(os.Stderr)
+		return errUsage
+	}
+
+	var book *gamelogic.Book
+	var err error
+	if set.NArgs() == 1 {
+		book, err = bookFromReplays(set.Arg(0), *plies)
+		if err != nil {
+			return err
+		}
+	} else {
+		book = bookFromSearches(*positions, *plies, *moveTime, *depth, *seed)
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return fmt.Errorf("could not create book: %v", err)
+	}
+	if err := book.Write(file); err != nil {
+		file.Close()
+		return fmt.Errorf("could not write book: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("could not write book: %v", err)
+	}
+	fmt.Printf("wrote %d positions to %s\n", book.Len(), *out)
+	return nil
+}
+
+func bookFromSearches(positions int, plies int, moveTime time.Duration, depth int, seed int64) *gamelogic.Book {
+	book := gamelogic.NewBook()
+	controller := gamelogic.NewController(gamelogic.DefaultTranspositionMemory)
+	controller.SetMaxDepth(depth)
+	r := rand.New(rand.NewSource(seed))
+	rules := gamelogic.DefaultRules()
+	moveLogic := gamelogic.NewMoveLogic(rules)
+	for i := 0; i < positions; i++ {
+		state := gamelogic.NewGameState(gamelogic.NewStartBoard(r, rules))
+		state.StartColor = gamelogic.ColorRed
+		state.CurrentColor = gamelogic.ColorRed
+		if len(book.Moves(state.Board(), gamelogic.NewPlayer(state.CurrentColor))) > 0 {
+			// a symmetric variant of a position searched before
+			continue
+		}
+		for ply := 0; ply < plies; ply++ {
+			if over, _, _ := moveLogic.GameOver(state); over {
+				break
+			}
+			controller.UpdateState(state)
+			controller.SetPlayer(state.CurrentColor)
+			ctx, cancel := context.WithTimeout(context.Background(), moveTime)
+			move, heuristic, err := controller.Evaluate(ctx)
+			cancel()
+			if err != nil {
+				break
+			}
+			fmt.Printf("position %d, turn %d: %s, heuristic %.2f, depth %d\n", i+1, state.Turn, move.String(), heuristic, controller.Stats().Depth)
+			player := gamelogic.NewPlayer(state.CurrentColor)
+			book.Add(state.Board(), player, move, 1)
+			state = moveLogic.NextState(state, move)
+		}
+	}
+	return book
+}
+
+func bookFromReplays(dir string, plies int) (*gamelogic.Book, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		return nil, err
+	}
+	book := gamelogic.NewBook()
+	games := 0
+	for _, path := range paths {
+		r, err := replay.Load(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "skipping %s: %v\n", path, err)
+			continue
+		}
+		if r.Result == nil {
+			continue
+		}
+		games++
+		for i, state := range r.States {
+			if i >= plies || i >= len(r.Moves) || r.Moves[i] == nil {
+				break
+			}
+			// a win counts twice as much as a draw, lost games add nothing
+			weight := 1
+			if r.Result.Winner != nil {
+				weight = 0
+				if protocol.StringToColor(r.Result.Winner.Color) == state.CurrentColor {
+					weight = 2
+				}
+			}
+			if weight > 0 {
+				book.Add(state.Board(), gamelogic.NewPlayer(state.CurrentColor), r.Moves[i], weight)
+			}
+		}
+	}
+	if games == 0 {
+		return nil, fmt.Errorf("no finished games in %s", dir)
+	}
+	fmt.Printf("read %d games\n", games)
+	return book, nil
+}
+
+func loadBook(path string) (*gamelogic.Book, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open book: %v", err)
+	}
+	defer file.Close()
+	return gamelogic.LoadBook(file)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"PWBSS2019/capture"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+var recordings int32
+
+// record tees the traffic of in and out into the files
+// <timestamp>-<pid>-<n>-in.capture and <timestamp>-<pid>-<n>-out.capture in
+// dir, n counts the recordings of this process.
+func record(dir string, in io.Reader, out io.Writer) (io.Reader, io.Writer, func(), error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, nil, err
+	}
+	start := time.Now()
+	n := atomic.AddInt32(&recordings, 1)
+	prefix := filepath.Join(dir, fmt.Sprintf("%s-%d-%d", start.Format("20060102-150405"), os.Getpid(), n))
+	inFile, err := os.Create(prefix + "-in.capture")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	outFile, err := os.Create(prefix + "-out.capture")
+	if err != nil {
+		inFile.Close()
+		return nil, nil, nil, err
+	}
+	fmt.Printf("recording traffic to %s-*.capture\n", prefix)
+
+	stop := func() {
+		inFile.Close()
+		outFile.Close()
+	}
+	return capture.TeeReader(in, capture.NewRecorder(inFile, start)), capture.TeeWriter(out, capture.NewRecorder(outFile, start)), stop, nil
+}
+
+// playback feeds the incoming traffic recorded under prefix into Process with
+// its original timing and checks that the same moves are sent again. The
+// search of client has to be limited by depth, playback lifts all time
+// limits so the moves do not depend on the speed of the machine.
+func playback(ctx context.Context, client *Client, prefix string) error {
+	in, err := loadChunks(prefix + "-in.capture")
+	if err != nil {
+		return err
+	}
+	out, err := loadChunks(prefix + "-out.capture")
+	if err != nil {
+		return err
+	}
+
+	client.MoveTime = 0
+	client.Controller.SetTimeManager(nil)
+	verifier := capture.NewMoveVerifier(out)
+	if err := client.Process(ctx, capture.NewPlayer(in, true), verifier); err != nil {
+		return err
+	}
+	return verifier.Verify()
+}
+
+func loadChunks(path string) ([]capture.Chunk, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return capture.ReadChunks(file)
+}
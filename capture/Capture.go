@@ -0,0 +1,191 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// A capture file is a sequence of chunks, each written as a header line
+// "<nanoseconds since start> <length>" followed by the raw bytes and a
+// newline, so the original timing of the traffic can be restored.
+type Chunk struct {
+	Offset time.Duration
+	Data   []byte
+}
+
+type Recorder struct {
+	w     io.Writer
+	start time.Time
+	lock  sync.Mutex
+}
+
+func NewRecorder(w io.Writer, start time.Time) *Recorder {
+	return &Recorder{w: w, start: start}
+}
+
+func (r *Recorder) Record(p []byte) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, err := fmt.Fprintf(r.w, "%d %d\n", time.Since(r.start).Nanoseconds(), len(p)); err != nil {
+		return err
+	}
+	if _, err := r.w.Write(p); err != nil {
+		return err
+	}
+	_, err := io.WriteString(r.w, "\n")
+	return err
+}
+
+type teeReader struct {
+	r   io.Reader
+	rec *Recorder
+}
+
+// TeeReader returns a reader recording everything read from r.
+func TeeReader(r io.Reader, rec *Recorder) io.Reader {
+	return &teeReader{r: r, rec: rec}
+}
+
+func (t *teeReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if recErr := t.rec.Record(p[:n]); recErr != nil {
+			return n, recErr
+		}
+	}
+	return n, err
+}
+
+type teeWriter struct {
+	w   io.Writer
+	rec *Recorder
+}
+
+// TeeWriter returns a writer recording everything written to w.
+func TeeWriter(w io.Writer, rec *Recorder) io.Writer {
+	return &teeWriter{w: w, rec: rec}
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	if n > 0 {
+		if recErr := t.rec.Record(p[:n]); recErr != nil {
+			return n, recErr
+		}
+	}
+	return n, err
+}
+
+func ReadChunks(r io.Reader) ([]Chunk, error) {
+	var chunks []Chunk
+	buffered := bufio.NewReader(r)
+	for {
+		var offset int64
+		var length int
+		_, err := fmt.Fscanf(buffered, "%d %d\n", &offset, &length)
+		if err == io.EOF {
+			return chunks, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid chunk header after %d chunks: %v", len(chunks), err)
+		}
+		data := make([]byte, length+1)
+		if _, err := io.ReadFull(buffered, data); err != nil {
+			return nil, fmt.Errorf("truncated chunk %d: %v", len(chunks), err)
+		}
+		chunks = append(chunks, Chunk{Offset: time.Duration(offset), Data: data[:length]})
+	}
+}
+
+type player struct {
+	chunks  []Chunk
+	start   time.Time
+	timed   bool
+	pending []byte
+}
+
+// NewPlayer returns a reader yielding the recorded chunks. With timed set
+// every chunk is held back until its original offset has passed.
+func NewPlayer(chunks []Chunk, timed bool) io.Reader {
+	return &player{chunks: chunks, start: time.Now(), timed: timed}
+}
+
+func (p *player) Read(b []byte) (int, error) {
+	if len(p.pending) == 0 {
+		if len(p.chunks) == 0 {
+			return 0, io.EOF
+		}
+		chunk := p.chunks[0]
+		p.chunks = p.chunks[1:]
+		if p.timed {
+			time.Sleep(time.Until(p.start.Add(chunk.Offset)))
+		}
+		p.pending = chunk.Data
+	}
+	n := copy(b, p.pending)
+	p.pending = p.pending[n:]
+	return n, nil
+}
+
+// MoveVerifier is a writer expecting the moves of a recorded outgoing stream
+// in the same order. Any other outgoing traffic is ignored.
+type MoveVerifier struct {
+	expected []string
+	count    int
+}
+
+func NewMoveVerifier(chunks []Chunk) *MoveVerifier {
+	var stream bytes.Buffer
+	for _, chunk := range chunks {
+		stream.Write(chunk.Data)
+	}
+	return &MoveVerifier{expected: extractMoves(stream.Bytes())}
+}
+
+func (v *MoveVerifier) Write(p []byte) (int, error) {
+	for _, move := range extractMoves(p) {
+		if v.count >= len(v.expected) {
+			return 0, fmt.Errorf("move %d (%s) was not recorded", v.count+1, move)
+		}
+		if v.expected[v.count] != move {
+			return 0, fmt.Errorf("move %d differs: recorded %s, got %s", v.count+1, v.expected[v.count], move)
+		}
+		v.count++
+	}
+	return len(p), nil
+}
+
+// Verify reports moves which were recorded but never sent.
+func (v *MoveVerifier) Verify() error {
+	if v.count != len(v.expected) {
+		return fmt.Errorf("sent %d of %d recorded moves", v.count, len(v.expected))
+	}
+	return nil
+}
+
+func extractMoves(data []byte) []string {
+	var moves []string
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		v, err := d.Token()
+		if err != nil {
+			return moves
+		}
+		t, ok := v.(xml.StartElement)
+		if !ok || t.Name.Local != "data" {
+			continue
+		}
+		attrs := make(map[string]string)
+		for _, a := range t.Attr {
+			attrs[a.Name.Local] = a.Value
+		}
+		if attrs["class"] == "move" {
+			moves = append(moves, fmt.Sprintf("%s %s %s", attrs["x"], attrs["y"], attrs["direction"]))
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package capture
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+const (
+	firstMove  = "<room roomId=\"r\"><data class=\"move\" x=\"0\" y=\"1\" direction=\"RIGHT\"/></room>"
+	secondMove = "<room roomId=\"r\"><data class=\"move\" x=\"9\" y=\"4\" direction=\"UP_LEFT\"/></room>"
+	otherMove  = "<room roomId=\"r\"><data class=\"move\" x=\"9\" y=\"4\" direction=\"DOWN\"/></room>"
+)
+
+// TestRoundTrip records both directions of a client stream, reads the
+// chunks back and replays them.
+func TestRoundTrip(t *testing.T) {
+	start := time.Now()
+	incoming := "<protocol>\n<joined roomId=\"r\"/>\n<room roomId=\"r\"><data class=\"sc.framework.plugins.protocol.MoveRequest\"/></room>"
+	var in, out bytes.Buffer
+	// reading byte by byte splits the stream into many chunks
+	received, err := ioutil.ReadAll(iotest.OneByteReader(TeeReader(strings.NewReader(incoming), NewRecorder(&in, start))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(received) != incoming {
+		t.Fatalf("tee reader passed %q, expected %q", received, incoming)
+	}
+	var sent bytes.Buffer
+	w := TeeWriter(&sent, NewRecorder(&out, start))
+	for _, s := range []string{"<protocol>", "<join gameType=\"swc_2019_piranhas\"/>", firstMove, secondMove} {
+		if _, err := io.WriteString(w, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inChunks, err := ReadChunks(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inChunks) < 2 {
+		t.Fatalf("read %d incoming chunks, expected several", len(inChunks))
+	}
+	outChunks, err := ReadChunks(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outChunks) != 4 {
+		t.Fatalf("read %d outgoing chunks, expected 4", len(outChunks))
+	}
+	for i := 1; i < len(outChunks); i++ {
+		if outChunks[i].Offset < outChunks[i-1].Offset {
+			t.Errorf("chunk %d at %v precedes chunk %d at %v", i, outChunks[i].Offset, i-1, outChunks[i-1].Offset)
+		}
+	}
+	replayed, err := ioutil.ReadAll(NewPlayer(inChunks, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(replayed) != incoming {
+		t.Errorf("player replayed %q, expected %q", replayed, incoming)
+	}
+	replayed, err = ioutil.ReadAll(NewPlayer(outChunks, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(replayed) != sent.String() {
+		t.Errorf("timed player replayed %q, expected %q", replayed, sent.String())
+	}
+
+	tests := []struct {
+		name      string
+		writes    []string
+		writeErr  bool
+		verifyErr bool
+	}{
+		{name: "same moves", writes: []string{"<protocol>", firstMove, secondMove}},
+		{name: "mismatch", writes: []string{firstMove, otherMove}, writeErr: true, verifyErr: true},
+		{name: "missing move", writes: []string{firstMove}, verifyErr: true},
+		{name: "extra move", writes: []string{firstMove, secondMove, otherMove}, writeErr: true},
+	}
+	for _, test := range tests {
+		v := NewMoveVerifier(outChunks)
+		var writeErr error
+		for _, s := range test.writes {
+			if _, err := io.WriteString(v, s); err != nil {
+				writeErr = err
+				break
+			}
+		}
+		if (writeErr != nil) != test.writeErr {
+			t.Errorf("%s: write returned %v", test.name, writeErr)
+		}
+		if err := v.Verify(); (err != nil) != test.verifyErr {
+			t.Errorf("%s: verify returned %v", test.name, err)
+		}
+	}
+}
+
+func TestReadChunksTruncated(t *testing.T) {
+	if _, err := ReadChunks(strings.NewReader("0 10\nshort\n")); err == nil {
+		t.Errorf("truncated chunk was read without error")
+	}
+	if _, err := ReadChunks(strings.NewReader("header\n")); err == nil {
+		t.Errorf("invalid header was read without error")
+	}
+}
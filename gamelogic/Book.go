@@ -0,0 +1,247 @@
+package gamelogic
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+)
+
+// The board looks the same to both players when mirrored horizontally,
+// vertically or both, so these positions share their book entries. A
+// symmetry is a bit set of mirrorX and mirrorY.
+const (
+	mirrorX    = 1
+	mirrorY    = 2
+	symmetries = 4
+)
+
+func (b *Board) symmetricHash(symmetry int) uint64 {
+	if symmetry == 0 {
+		return b.Hash()
+	}
+	var hash uint64
+	for y := 0; y < b.height; y++ {
+		for x := 0; x < b.width; x++ {
+			tx, ty := b.transform(x, y, symmetry)
+			hash ^= zobristKeys[ty][tx][b.GetField(x, y).T]
+		}
+	}
+	return hash
+}
+
+func (b *Board) transform(x int, y int, symmetry int) (int, int) {
+	if symmetry&mirrorX != 0 {
+		x = b.width - 1 - x
+	}
+	if symmetry&mirrorY != 0 {
+		y = b.height - 1 - y
+	}
+	return x, y
+}
+
+func transformDirection(d Direction, symmetry int) Direction {
+	if symmetry&mirrorX != 0 {
+		switch d {
+		case DirectionLeft:
+			d = DirectionRight
+		case DirectionRight:
+			d = DirectionLeft
+		case DirectionUpLeft:
+			d = DirectionUpRight
+		case DirectionUpRight:
+			d = DirectionUpLeft
+		case DirectionDownLeft:
+			d = DirectionDownRight
+		case DirectionDownRight:
+			d = DirectionDownLeft
+		}
+	}
+	if symmetry&mirrorY != 0 {
+		switch d {
+		case DirectionUp:
+			d = DirectionDown
+		case DirectionDown:
+			d = DirectionUp
+		case DirectionUpLeft:
+			d = DirectionDownLeft
+		case DirectionDownLeft:
+			d = DirectionUpLeft
+		case DirectionUpRight:
+			d = DirectionDownRight
+		case DirectionDownRight:
+			d = DirectionUpRight
+		}
+	}
+	return d
+}
+
+// transformMove mirrors a move, every symmetry is its own inverse.
+func (b *Board) transformMove(move *Move, symmetry int) *Move {
+	x, y := b.transform(move.X, move.Y, symmetry)
+	return NewMove(x, y, transformDirection(move.Direction, symmetry))
+}
+
+// canonicalHash returns the smallest hash of all symmetric variants of the
+// board with player to move and the symmetry producing it.
+func canonicalHash(board *Board, player *Player) (uint64, int) {
+	var best uint64
+	bestSymmetry := 0
+	for s := 0; s < symmetries; s++ {
+		hash := board.symmetricHash(s)
+		if player.color == ColorBlue {
+			hash = ^hash
+		}
+		if s == 0 || hash < best {
+			best = hash
+			bestSymmetry = s
+		}
+	}
+	return best, bestSymmetry
+}
+
+type BookMove struct {
+	Move   *Move
+	Weight int
+}
+
+// Book maps positions to weighted moves. Moves are stored for the canonical
+// variant of the position.
+type Book struct {
+	entries map[uint64][]BookMove
+}
+
+func NewBook() *Book {
+	return &Book{entries: make(map[uint64][]BookMove)}
+}
+
+func (b *Book) Len() int {
+	return len(b.entries)
+}
+
+// Add adds weight to the move of player on board.
+func (b *Book) Add(board *Board, player *Player, move *Move, weight int) {
+	key, symmetry := canonicalHash(board, player)
+	move = board.transformMove(move, symmetry)
+	moves := b.entries[key]
+	for i := range moves {
+		if *moves[i].Move == *move {
+			moves[i].Weight += weight
+			return
+		}
+	}
+	b.entries[key] = append(moves, BookMove{Move: move, Weight: weight})
+}
+
+// Moves returns the book moves of player on board.
+func (b *Book) Moves(board *Board, player *Player) []BookMove {
+	key, symmetry := canonicalHash(board, player)
+	var moves []BookMove
+	for _, m := range b.entries[key] {
+		if m.Weight > 0 {
+			moves = append(moves, BookMove{Move: board.transformMove(m.Move, symmetry), Weight: m.Weight})
+		}
+	}
+	return moves
+}
+
+// Pick chooses one of the book moves at random in proportion to its weight,
+// it returns nil if the position is not in the book.
+func (b *Book) Pick(board *Board, player *Player, r *rand.Rand) *Move {
+	moves := b.Moves(board, player)
+	total := 0
+	for _, m := range moves {
+		total += m.Weight
+	}
+	if total == 0 {
+		return nil
+	}
+	n := r.Intn(total)
+	for _, m := range moves {
+		if n < m.Weight {
+			return m.Move
+		}
+		n -= m.Weight
+	}
+	return nil
+}
+
+// The binary book format starts with bookMagic and the number of entries,
+// followed by the entries ordered by key. Each entry is the key, the x and y
+// coordinate and direction of the move as one byte each and the weight,
+// all numbers little endian.
+var bookMagic = [4]byte{'P', 'B', 'K', '1'}
+
+const maxBookWeight = 1<<16 - 1
+
+type bookRecord struct {
+	Key       uint64
+	X         uint8
+	Y         uint8
+	Direction uint8
+	Weight    uint16
+}
+
+func (b *Book) Write(w io.Writer) error {
+	var records []bookRecord
+	for key, moves := range b.entries {
+		for _, m := range moves {
+			weight := m.Weight
+			if weight > maxBookWeight {
+				weight = maxBookWeight
+			}
+			records = append(records, bookRecord{key, uint8(m.Move.X), uint8(m.Move.Y), uint8(m.Move.Direction), uint16(weight)})
+		}
+	}
+	sort.Slice(records, func(l, r int) bool {
+		if records[l].Key != records[r].Key {
+			return records[l].Key < records[r].Key
+		}
+		return records[l].Weight > records[r].Weight
+	})
+
+	buffered := bufio.NewWriter(w)
+	if _, err := buffered.Write(bookMagic[:]); err != nil {
+		return err
+	}
+	if err := binary.Write(buffered, binary.LittleEndian, uint32(len(records))); err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := binary.Write(buffered, binary.LittleEndian, record); err != nil {
+			return err
+		}
+	}
+	return buffered.Flush()
+}
+
+func LoadBook(r io.Reader) (*Book, error) {
+	buffered := bufio.NewReader(r)
+	var magic [4]byte
+	if _, err := io.ReadFull(buffered, magic[:]); err != nil {
+		return nil, fmt.Errorf("could not read book header: %v", err)
+	}
+	if magic != bookMagic {
+		return nil, fmt.Errorf("not an opening book")
+	}
+	var count uint32
+	if err := binary.Read(buffered, binary.LittleEndian, &count); err != nil {
+		return nil, fmt.Errorf("could not read book header: %v", err)
+	}
+
+	book := NewBook()
+	for i := uint32(0); i < count; i++ {
+		var record bookRecord
+		if err := binary.Read(buffered, binary.LittleEndian, &record); err != nil {
+			return nil, fmt.Errorf("could not read book entry %d of %d: %v", i+1, count, err)
+		}
+		if record.X >= MaxBoardSize || record.Y >= MaxBoardSize || record.Direction > uint8(DirectionUpLeft) {
+			return nil, fmt.Errorf("invalid move in book entry %d", i+1)
+		}
+		move := NewMove(int(record.X), int(record.Y), Direction(record.Direction))
+		book.entries[record.Key] = append(book.entries[record.Key], BookMove{Move: move, Weight: int(record.Weight)})
+	}
+	return book, nil
+}
@@ -1,9 +1,11 @@
 package gamelogic
 
 import (
+	"context"
 	"fmt"
 	"math"
-	"sort"
+	"math/rand"
+	"time"
 )
 
 type Controller struct {
@@ -12,32 +14,82 @@ type Controller struct {
 	ownPlayer     *Player
 	foreignPlayer *Player
 	moveLogic     *MoveLogic
-	calcPerRound  int
+	tt            *TranspositionTable
+	ordering      moveOrdering
+	noOrdering    bool
+	maxDepth      int
+	options       SearchOptions
+	endgame       EndgameSolution
+	stats         SearchStats
+	pvTable       [maxPly + 1][]*Move
+	pv            []*Move
+	book          *Book
+	bookRand      *rand.Rand
+	inBook        bool
+	ponder        *ponder
+	resume        *ponderResult
+	timeManager   *TimeManager
+	clock         *moveClock
+	report        MoveReport
+	trace         *searchTrace
 }
 
+const DefaultTranspositionMemory = 64 << 20
+
 func (c *Controller) RoomID() string {
 	return c.roomID
 }
 
-var singleton *Controller = nil
+// NewController creates a controller whose transposition table uses at most
+// ttMemory bytes. Every game needs its own controller.
+func NewController(ttMemory int) *Controller {
+	return &Controller{moveLogic: &MoveLogic{}, tt: NewTranspositionTable(ttMemory), options: DefaultSearchOptions()}
+}
 
-func GetController() *Controller {
-	if singleton == nil {
-		singleton = &Controller{moveLogic: &MoveLogic{}}
-	}
-	return singleton
+func (c *Controller) State() *GameState {
+	c.stopPondering()
+	return c.state
 }
 
-func (c *Controller) UpdateState(newstate *GameState) {
+// UpdateState replaces the current state. If the new state directly follows
+// the old one its last move is checked, an error reports a move the rules
+// engine considers illegal. The new state is used nevertheless, as the
+// server decides what is legal. A state not following the pondered line
+// stops pondering.
+func (c *Controller) UpdateState(newstate *GameState) error {
+	if c.updatePondering(newstate) {
+		return nil
+	}
+	old := c.state
 	c.state = newstate
+	if newstate.Rules != c.moveLogic.rules {
+		c.moveLogic = NewMoveLogic(newstate.Rules)
+	}
+	if old == nil || newstate.LastMove == nil || newstate.Turn != old.Turn+1 {
+		return nil
+	}
+	return c.moveLogic.ValidateTransition(old.board, newstate.board, NewPlayer(old.CurrentColor), newstate.LastMove)
+}
+
+// ValidateMove checks a move of the own player in the current state.
+func (c *Controller) ValidateMove(move *Move) error {
+	c.stopPondering()
+	if !c.readyToPlay() {
+		return fmt.Errorf("controller is not ready to play")
+	}
+	return c.moveLogic.ValidateMove(c.state.board, c.ownPlayer, move)
 }
 
 func (c *Controller) JoinRoom(roomID string) {
+	c.stopPondering()
+	c.resume = nil
 	c.roomID = roomID
-	//TODO reset state
+	c.state = nil
+	c.tt.Clear()
 }
 
 func (c *Controller) SetPlayer(ownColor Color) {
+	c.stopPondering()
 	c.ownPlayer = NewPlayer(ownColor)
 	c.foreignPlayer = NewPlayer(ownColor.OppositeColor())
 }
@@ -47,16 +99,16 @@ func (c *Controller) readyToPlay() bool {
 }
 
 func (c *Controller) CalculateStaticHeuristic(board *Board, oldBoard *Board, move *Move) float64 {
-	c.calcPerRound += 1
 	heuristic := 0.0
 
 	targetField := c.moveLogic.GetFieldInDirection(oldBoard, move, c.moveLogic.CalculateMoveDistance(oldBoard, oldBoard.GetField(move.X, move.Y), move.Direction))
+	center := float64(board.width-1) / 2
 
 	//heuristic += c.moveLogic.CalculateSwarmDistance(oldBoard, c.ownPlayer) - c.moveLogic.CalculateSwarmDistance(board, c.ownPlayer)
 	heuristic += c.moveLogic.CalculateDistanceToSwarm(oldBoard, c.ownPlayer) - c.moveLogic.CalculateDistanceToSwarm(board, c.ownPlayer)
 	heuristic += float64(c.moveLogic.CalculateSwarmSize(board, c.ownPlayer)) - float64(c.moveLogic.CalculateSwarmSize(oldBoard, c.ownPlayer))
-	heuristic += math.Min(math.Abs(float64(move.X)-4.5), math.Abs(float64(move.Y)-4.5))
-	heuristic -= math.Max(math.Abs(float64(targetField.X)-4.5), math.Abs(float64(targetField.Y)-4.5))
+	heuristic += math.Min(math.Abs(float64(move.X)-center), math.Abs(float64(move.Y)-center))
+	heuristic -= math.Max(math.Abs(float64(targetField.X)-center), math.Abs(float64(targetField.Y)-center))
 
 	if c.moveLogic.HasPlayerWon(board, c.ownPlayer) {
 		heuristic += 1000000.0
@@ -66,7 +118,7 @@ func (c *Controller) CalculateStaticHeuristic(board *Board, oldBoard *Board, mov
 		heuristic = -100000.0
 	}
 	if targetField.IsPiranhaOfPlayer(c.foreignPlayer) {
-		heuristic += 5 - math.Max(math.Abs(float64(move.X)-4.5), math.Abs(float64(move.Y)-4.5))
+		heuristic += center + 0.5 - math.Max(math.Abs(float64(move.X)-center), math.Abs(float64(move.Y)-center))
 	}
 
 	heuristic += (float64(c.moveLogic.CalculateSwarmSize(oldBoard, c.foreignPlayer)) - float64(c.moveLogic.CalculateSwarmSize(board, c.foreignPlayer))) / 2
@@ -76,69 +128,136 @@ func (c *Controller) CalculateStaticHeuristic(board *Board, oldBoard *Board, mov
 	return heuristic
 }
 
-func (c *Controller) CalculateDynamicHeuristic(board *Board, depth int) float64 {
-	moveHeuristic := 0.0
+// NextTurn searches the best move for the current state. When ctx is done
+// the search stops and the best move found so far is returned together with
+// the principal variation starting with it.
+func (c *Controller) NextTurn(ctx context.Context) (*Move, []*Move, error) {
+	bestMove, bestHeuristic, err := c.Evaluate(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	if depth != 0 && c.calcPerRound < 50000 {
-		possibleMoves := c.moveLogic.GetPossibleMoves(board, c.ownPlayer)
-		type ratedMove struct {
-			heuristic float64
-			board     *Board
-			move      *Move
-		}
-		var moves []ratedMove
+	fmt.Printf("%+v\n", bestMove)
+	if c.inBook {
+		fmt.Println("book move")
+		return bestMove, c.pv, nil
+	}
+	if c.endgame.Outcome != OutcomeUnknown {
+		fmt.Printf("endgame: forced %s in %d plies\n", c.endgame.Outcome, c.endgame.Distance)
+	}
+	if c.stats.TimeBudget > 0 {
+		fmt.Printf("time budget %v\n", c.stats.TimeBudget)
+	}
+	if c.stats.PonderDepth > 0 {
+		fmt.Printf("ponder hit, resumed after depth %d\n", c.stats.PonderDepth)
+	}
+	fmt.Printf("heuristic %.2f, depth %d, %d nodes, %.0f nps, tt hit rate %.2f, cutoff rate %.2f, pv %s\n", bestHeuristic, c.stats.Depth, c.stats.Nodes, c.report.NPS, c.report.TTHitRate, c.stats.CutoffRate(), FormatMoves(c.pv))
 
-		for _, m := range possibleMoves {
-			targetBoard := c.moveLogic.ApplyMove(board, m)
-			staticHeuristic := c.CalculateStaticHeuristic(targetBoard, board, m)
-			moves = append(moves, ratedMove{staticHeuristic, targetBoard, m})
-		}
+	return bestMove, c.pv, nil
+}
 
-		sort.Slice(moves, func(l, r int) bool {
-			return moves[l].heuristic > moves[r].heuristic
-		})
-		maxBreath := 60
-		if len(moves) < maxBreath {
-			maxBreath = len(moves)
-		}
+// Evaluate runs the move search for the current state and returns the best
+// move together with its heuristic. Afterwards Report describes the search.
+func (c *Controller) Evaluate(ctx context.Context) (bestMove *Move, bestHeuristic float64, err error) {
+	c.stopPondering()
+	if !c.readyToPlay() {
+		return nil, 0, fmt.Errorf("controller is not ready to play")
+	}
+	moves := len(c.moveLogic.GetPossibleMoves(c.state.board, c.ownPlayer))
+	if moves == 0 {
+		return nil, 0, fmt.Errorf("no possible moves")
+	}
+	start := time.Now()
+	defer func() {
+		c.report = c.newReport(bestMove, bestHeuristic, moves, time.Since(start))
+	}()
+	if c.timeManager != nil {
+		c.clock = c.timeManager.newClock(c, moves)
+		defer func() { c.clock = nil }()
+		var cancel context.CancelFunc
+		ctx, cancel = c.clock.hardContext(ctx)
+		defer cancel()
+	}
 
-		for _, m := range moves[:maxBreath] {
-			nextDepth := depth - 1
-			heuristic := c.CalculateDynamicHeuristic(m.board, nextDepth)/4 + m.heuristic
-			if heuristic > moveHeuristic {
-				moveHeuristic = heuristic
-			}
+	c.endgame = EndgameSolution{}
+	c.inBook = false
+	if move := c.bookMove(); move != nil {
+		c.inBook = true
+		c.stats = SearchStats{}
+		c.pv = []*Move{move}
+		return move, 0, nil
+	}
+	if c.IsEndgame() {
+		solveCtx, cancel := endgameContext(ctx)
+		c.endgame = c.SolveEndgame(solveCtx)
+		cancel()
+		if c.endgame.Outcome != OutcomeUnknown {
+			c.stats = SearchStats{Nodes: c.endgame.Nodes}
+			c.pv = []*Move{c.endgame.Move}
+			return c.endgame.Move, c.endgame.Heuristic(), nil
 		}
 	}
+	move, heuristic := c.search(ctx)
+	return move, heuristic, nil
+}
 
-	return moveHeuristic
+// SetBook makes the controller play moves from book while the position is in
+// it, r chooses between the weighted moves.
+func (c *Controller) SetBook(book *Book, r *rand.Rand) {
+	c.book = book
+	c.bookRand = r
 }
 
-func (c *Controller) NextTurn() (*Move, error) {
-	c.calcPerRound = 0
+// InBook tells whether the last evaluation took its move from the book.
+func (c *Controller) InBook() bool {
+	return c.inBook
+}
+
+// bookMove returns a legal move from the book or nil. The book only knows
+// boards, so moves are checked against the rules of the current game.
+func (c *Controller) bookMove() *Move {
+	if c.book == nil {
+		return nil
+	}
+	move := c.book.Pick(c.state.board, c.ownPlayer, c.bookRand)
+	if move == nil || c.moveLogic.ValidateMove(c.state.board, c.ownPlayer, move) != nil {
+		return nil
+	}
+	return move
+}
+
+// QuickMove returns the move with the best static heuristic without any
+// lookahead. It is meant as a cheap fallback when the regular search fails.
+func (c *Controller) QuickMove() (*Move, error) {
+	c.stopPondering()
 	if !c.readyToPlay() {
 		return nil, fmt.Errorf("controller is not ready to play")
 	}
 
-	possibleMoves := c.moveLogic.GetPossibleMoves(c.state.board, c.ownPlayer)
-
-	bestMove := possibleMoves[0]
-	bestHeuristic := -1000000000.0
-	for _, move := range possibleMoves {
-		targetBoard := c.moveLogic.ApplyMove(c.state.board, move)
-
-		moveHeuristic := c.CalculateStaticHeuristic(targetBoard, c.state.board, move)
-		moveHeuristic += c.CalculateDynamicHeuristic(targetBoard, 1) / 4
-
-		if moveHeuristic > bestHeuristic {
-			bestHeuristic = moveHeuristic
+	var bestMove *Move
+	bestHeuristic := 0.0
+	for _, move := range c.moveLogic.GetPossibleMoves(c.state.board, c.ownPlayer) {
+		heuristic := c.CalculateStaticHeuristic(c.moveLogic.ApplyMove(c.state.board, move), c.state.board, move)
+		if bestMove == nil || heuristic > bestHeuristic {
+			bestHeuristic = heuristic
 			bestMove = move
 		}
 	}
-
-	fmt.Printf("%+v\n", bestMove)
-	println(bestHeuristic)
-	println(c.calcPerRound)
-
+	if bestMove == nil {
+		return nil, fmt.Errorf("no possible moves")
+	}
 	return bestMove, nil
 }
+
+// AnyMove returns the first legal move of the own player.
+func (c *Controller) AnyMove() (*Move, error) {
+	c.stopPondering()
+	if !c.readyToPlay() {
+		return nil, fmt.Errorf("controller is not ready to play")
+	}
+	moves := c.moveLogic.GetPossibleMoves(c.state.board, c.ownPlayer)
+	if len(moves) == 0 {
+		return nil, fmt.Errorf("no possible moves")
+	}
+	return moves[0], nil
+}
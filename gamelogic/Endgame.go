@@ -0,0 +1,268 @@
+package gamelogic
+
+import (
+	"context"
+	"time"
+)
+
+type Outcome int
+
+const (
+	OutcomeUnknown Outcome = 0
+	OutcomeWin     Outcome = 1
+	OutcomeDraw    Outcome = 2
+	OutcomeLoss    Outcome = 3
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeWin:
+		return "win"
+	case OutcomeDraw:
+		return "draw"
+	case OutcomeLoss:
+		return "loss"
+	}
+	return "unknown"
+}
+
+func (o Outcome) opposite() Outcome {
+	switch o {
+	case OutcomeWin:
+		return OutcomeLoss
+	case OutcomeLoss:
+		return OutcomeWin
+	}
+	return o
+}
+
+// EndgameSolution is the result of the endgame solver from the view of the
+// own player. Unless the outcome is unknown it is forced: Move achieves it
+// against every defence and the game ends after Distance plies.
+type EndgameSolution struct {
+	Outcome  Outcome
+	Distance int
+	Move     *Move
+	Depth    int
+	Nodes    int
+}
+
+// Heuristic rates a solved position on the scale of the search.
+func (s EndgameSolution) Heuristic() float64 {
+	switch s.Outcome {
+	case OutcomeWin:
+		return winScore - float64(s.Distance)
+	case OutcomeLoss:
+		return -winScore + float64(s.Distance)
+	}
+	return 0
+}
+
+// MovesToConnect estimates how many moves the player needs to connect all
+// piranhas, every piranha outside the largest swarm has to move at least
+// once unless another piranha bridges the gap.
+func (m *MoveLogic) MovesToConnect(board *Board, player *Player) int {
+	return m.GetPiranhaCount(board, player) - m.CalculateSwarmSize(board, player)
+}
+
+func (c *Controller) Endgame() EndgameSolution {
+	return c.endgame
+}
+
+// IsEndgame tells whether the current state is small enough for the
+// endgame solver: both players have at most EndgamePiranhas piranhas or one
+// of them is at most EndgameMovesToConnect moves away from connecting.
+func (c *Controller) IsEndgame() bool {
+	if !c.readyToPlay() {
+		return false
+	}
+	board := c.state.board
+	if c.options.EndgamePiranhas > 0 &&
+		c.moveLogic.GetPiranhaCount(board, c.ownPlayer) <= c.options.EndgamePiranhas &&
+		c.moveLogic.GetPiranhaCount(board, c.foreignPlayer) <= c.options.EndgamePiranhas {
+		return true
+	}
+	if c.options.EndgameMovesToConnect > 0 {
+		for _, player := range []*Player{c.ownPlayer, c.foreignPlayer} {
+			if c.moveLogic.MovesToConnect(board, player) <= c.options.EndgameMovesToConnect {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type solverEntry struct {
+	outcome  Outcome
+	distance int
+	depth    int
+}
+
+type endgameSolver struct {
+	c       *Controller
+	ctx     context.Context
+	entries map[uint64]solverEntry
+	nodes   int
+	aborted bool
+}
+
+// SolveEndgame searches the current state for a forced outcome. Only the
+// rules decide: a position is won, drawn or lost once every line ends with
+// the game. The search deepens until the outcome is known, the end of the
+// game is reached or ctx is done.
+func (c *Controller) SolveEndgame(ctx context.Context) EndgameSolution {
+	if !c.readyToPlay() {
+		return EndgameSolution{}
+	}
+	s := &endgameSolver{c: c, ctx: ctx, entries: make(map[uint64]solverEntry)}
+	var solution EndgameSolution
+	remaining := c.state.Rules.TurnLimit - c.state.Turn
+	if c.maxDepth > 0 && c.maxDepth < remaining {
+		remaining = c.maxDepth
+	}
+	for depth := 1; depth <= remaining && depth <= maxPly; depth++ {
+		result := s.solveRoot(depth)
+		if s.aborted {
+			break
+		}
+		solution = result
+		if solution.Outcome != OutcomeUnknown {
+			break
+		}
+	}
+	solution.Nodes = s.nodes
+	return solution
+}
+
+func (s *endgameSolver) solveRoot(depth int) EndgameSolution {
+	c := s.c
+	board := c.state.board
+	solution := EndgameSolution{Depth: depth, Outcome: OutcomeLoss}
+	var draw *Move
+	unknown := false
+	for _, move := range c.moveLogic.GetPossibleMoves(board, c.ownPlayer) {
+		outcome, distance := s.solve(c.moveLogic.ApplyMove(board, move), c.state.Turn+1, depth-1, c.foreignPlayer, c.ownPlayer)
+		if s.aborted {
+			return EndgameSolution{}
+		}
+		outcome = outcome.opposite()
+		distance++
+		switch outcome {
+		case OutcomeWin:
+			// look for the fastest win
+			if solution.Outcome != OutcomeWin || distance < solution.Distance {
+				solution = EndgameSolution{Outcome: OutcomeWin, Distance: distance, Move: move, Depth: depth}
+			}
+		case OutcomeDraw:
+			draw = move
+		case OutcomeUnknown:
+			unknown = true
+		case OutcomeLoss:
+			// delay a loss as long as possible
+			if solution.Outcome == OutcomeLoss && (solution.Move == nil || distance > solution.Distance) {
+				solution.Move = move
+				solution.Distance = distance
+			}
+		}
+	}
+	switch {
+	case solution.Outcome == OutcomeWin:
+		return solution
+	case unknown || solution.Move == nil && draw == nil:
+		return EndgameSolution{Depth: depth}
+	case draw != nil:
+		return EndgameSolution{Outcome: OutcomeDraw, Move: draw, Depth: depth}
+	}
+	return solution
+}
+
+// solve returns the outcome for player to move in turn together with the
+// number of plies until the game ends, the fewest for a win and the most for
+// a loss. Positions which are not decided within depth plies are unknown. A
+// decided outcome and its distance do not depend on depth, as every shorter
+// line was searched, so they are reused from the entries at any depth.
+func (s *endgameSolver) solve(board *Board, turn int, depth int, player *Player, opponent *Player) (Outcome, int) {
+	c := s.c
+	s.nodes++
+	if s.nodes%1024 == 0 && s.ctx.Err() != nil {
+		s.aborted = true
+	}
+	if s.aborted {
+		return OutcomeUnknown, 0
+	}
+	if over, heuristic := c.gameOver(board, turn, 0, player, opponent); over {
+		return outcomeOf(heuristic), 0
+	}
+	moves := c.moveLogic.GetPossibleMoves(board, player)
+	if len(moves) == 0 {
+		return outcomeOf(c.finalHeuristic(board, 0, player, opponent)), 0
+	}
+	if depth == 0 {
+		return OutcomeUnknown, 0
+	}
+
+	key := positionHash(board, player, turn)
+	if entry, ok := s.entries[key]; ok && (entry.outcome != OutcomeUnknown || entry.depth >= depth) {
+		return entry.outcome, entry.distance
+	}
+
+	outcome := OutcomeLoss
+	distance := 0
+	unknown := false
+	draw := false
+	for _, move := range moves {
+		o, d := s.solve(c.moveLogic.ApplyMove(board, move), turn+1, depth-1, opponent, player)
+		if s.aborted {
+			return OutcomeUnknown, 0
+		}
+		switch o.opposite() {
+		case OutcomeWin:
+			// look for the fastest win, none is faster than the next ply
+			if outcome != OutcomeWin || d+1 < distance {
+				outcome = OutcomeWin
+				distance = d + 1
+			}
+		case OutcomeDraw:
+			draw = true
+		case OutcomeUnknown:
+			unknown = true
+		case OutcomeLoss:
+			if outcome == OutcomeLoss && d+1 > distance {
+				distance = d + 1
+			}
+		}
+		if outcome == OutcomeWin && distance == 1 {
+			break
+		}
+	}
+	if outcome != OutcomeWin {
+		switch {
+		case unknown:
+			outcome, distance = OutcomeUnknown, 0
+		case draw:
+			outcome, distance = OutcomeDraw, 0
+		}
+	}
+	s.entries[key] = solverEntry{outcome: outcome, distance: distance, depth: depth}
+	return outcome, distance
+}
+
+func outcomeOf(heuristic float64) Outcome {
+	switch {
+	case heuristic > 0:
+		return OutcomeWin
+	case heuristic < 0:
+		return OutcomeLoss
+	}
+	return OutcomeDraw
+}
+
+// endgameContext gives the solver half of the time left until the deadline
+// of ctx, so the regular search can still run if the outcome stays unknown.
+func endgameContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, time.Now().Add(time.Until(deadline)/2))
+}
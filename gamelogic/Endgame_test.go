@@ -0,0 +1,79 @@
+package gamelogic
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+)
+
+// endgameStates returns random states on small boards a few plies before
+// the turn limit.
+func endgameStates(r *rand.Rand, rules Rules, plies int, count int) []*GameState {
+	var states []*GameState
+	for len(states) < count {
+		if state := RandomState(r, rules, rules.TurnLimit-plies); state.Turn == rules.TurnLimit-plies {
+			states = append(states, state)
+		}
+	}
+	return states
+}
+
+// TestSolveEndgame compares the solver with a plain minimax search. Besides
+// deepening iteratively, every state is also solved directly at the full
+// depth, where the solver relies on its distances of interior positions.
+func TestSolveEndgame(t *testing.T) {
+	rules := Rules{Size: 5, TurnLimit: 12, Obstacles: 0, Adjacency: AdjacencyDiagonal}
+	plies := 5
+	for i, state := range endgameStates(rand.New(rand.NewSource(1)), rules, plies, 4) {
+		c := NewController(1 << 16)
+		c.SetPlayer(state.CurrentColor)
+		c.UpdateState(state)
+		results := make(map[uint64][2]int)
+		outcome, distance := minimaxEndgame(c, results, state.board, state.Turn, c.ownPlayer, c.foreignPlayer)
+
+		s := &endgameSolver{c: c, ctx: context.Background(), entries: make(map[uint64]solverEntry)}
+		for _, solution := range []EndgameSolution{c.SolveEndgame(context.Background()), s.solveRoot(plies)} {
+			if solution.Outcome != outcome || solution.Distance != distance {
+				t.Fatalf("state %d, depth %d: solved %s in %d plies, expected %s in %d plies\n%s", i, solution.Depth, solution.Outcome, solution.Distance, outcome, distance, state.board)
+			}
+			o, d := minimaxEndgame(c, results, c.moveLogic.ApplyMove(state.board, solution.Move), state.Turn+1, c.foreignPlayer, c.ownPlayer)
+			if o.opposite() != outcome || outcome != OutcomeDraw && d+1 != distance {
+				t.Fatalf("state %d, depth %d: move %v leads to %s in %d plies instead of %s in %d plies\n%s", i, solution.Depth, solution.Move, o.opposite(), d+1, outcome, distance, state.board)
+			}
+		}
+	}
+}
+
+// minimaxEndgame is the plain minimax reference for the solver, it searches
+// every line to the end of the game. Results holds the outcome and distance
+// of the positions already searched.
+func minimaxEndgame(c *Controller, results map[uint64][2]int, board *Board, turn int, player *Player, opponent *Player) (Outcome, int) {
+	if over, heuristic := c.gameOver(board, turn, 0, player, opponent); over {
+		return outcomeOf(heuristic), 0
+	}
+	moves := c.moveLogic.GetPossibleMoves(board, player)
+	if len(moves) == 0 {
+		return outcomeOf(c.finalHeuristic(board, 0, player, opponent)), 0
+	}
+	key := positionHash(board, player, turn)
+	if result, ok := results[key]; ok {
+		return Outcome(result[0]), result[1]
+	}
+	best, bestDistance := OutcomeUnknown, 0
+	for _, move := range moves {
+		o, d := minimaxEndgame(c, results, c.moveLogic.ApplyMove(board, move), turn+1, opponent, player)
+		o, d = o.opposite(), d+1
+		switch {
+		case best == OutcomeUnknown,
+			o == OutcomeWin && (best != OutcomeWin || d < bestDistance),
+			o == OutcomeDraw && best == OutcomeLoss,
+			o == OutcomeLoss && best == OutcomeLoss && d > bestDistance:
+			best, bestDistance = o, d
+		}
+	}
+	if best == OutcomeDraw {
+		bestDistance = 0
+	}
+	results[key] = [2]int{int(best), bestDistance}
+	return best, bestDistance
+}
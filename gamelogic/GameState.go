@@ -1,5 +1,11 @@
 package gamelogic
 
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
 type Player struct {
 	color Color
 }
@@ -25,22 +31,96 @@ func (c Color) OppositeColor() Color {
 
 type GameState struct {
 	board* Board
+	Turn int
+	StartColor Color
+	CurrentColor Color
+	LastMove *Move
+	Rules Rules
 }
 
+// NewGameState creates a state with the official rules for the size of the
+// given board.
 func NewGameState(board *Board) *GameState {
-	return &GameState{board: board}
+	rules := DefaultRules()
+	rules.Size = board.width
+	return &GameState{board: board, Rules: rules}
+}
+
+func (s *GameState) Board() *Board {
+	return s.board
 }
 
 type Board struct {
 	fields [][]*Field
 	width int
 	height int
-	swarm map[*Player][]*Field
+	swarms map[*Player][]Swarm
 	piranhas map[*Player][]*Field
+	hash uint64
+	hashed bool
 }
 
 func NewBoard(fields [][]*Field, width int, height int) *Board {
-	return &Board{fields: fields, width: width, height: height, swarm:make(map[*Player][]*Field), piranhas:make(map[*Player][]*Field)}
+	return &Board{fields: fields, width: width, height: height, swarms:make(map[*Player][]Swarm), piranhas:make(map[*Player][]*Field)}
+}
+
+// NewStartBoard creates the start position for the given rules, which must
+// be valid.
+func NewStartBoard(r *rand.Rand, rules Rules) *Board {
+	size := rules.Size
+	fields := make([][]*Field, size)
+	for y := range fields {
+		fields[y] = make([]*Field, size)
+		for x := range fields[y] {
+			t := FieldTypeEmpty
+			if (x == 0 || x == size-1) && y > 0 && y < size-1 {
+				t = FieldTypeRed
+			} else if (y == 0 || y == size-1) && x > 0 && x < size-1 {
+				t = FieldTypeBlue
+			}
+			fields[y][x] = NewField(x, y, t)
+		}
+	}
+
+	// obstacles in the inner area leaving a margin of two fields, no two of
+	// them may share a row, column or diagonal
+	var obstacles []*Field
+	for len(obstacles) < rules.Obstacles {
+		var candidates []*Field
+		for y := 2; y < size-2; y++ {
+			for x := 2; x < size-2; x++ {
+				free := true
+				for _, o := range obstacles {
+					if x == o.X || y == o.Y || x-y == o.X-o.Y || x+y == o.X+o.Y {
+						free = false
+						break
+					}
+				}
+				if free {
+					candidates = append(candidates, fields[y][x])
+				}
+			}
+		}
+		if len(candidates) == 0 {
+			// dead end, start over
+			obstacles = obstacles[:0]
+			continue
+		}
+		obstacles = append(obstacles, candidates[r.Intn(len(candidates))])
+	}
+	for _, o := range obstacles {
+		o.T = FieldTypeObstructed
+	}
+
+	return NewBoard(fields, size, size)
+}
+
+func (b *Board) Width() int {
+	return b.width
+}
+
+func (b *Board) Height() int {
+	return b.height
 }
 
 func (b *Board) GetField(x int, y int) *Field {
@@ -49,6 +129,7 @@ func (b *Board) GetField(x int, y int) *Field {
 
 func (b *Board) SetField(field *Field) {
 	b.fields[field.Y][field.X] = field
+	b.hashed = false
 }
 
 func (b *Board) Clone() *Board {
@@ -57,7 +138,35 @@ func (b *Board) Clone() *Board {
 		newFields[i] = make([]*Field, len(b.fields[i]))
 		copy(newFields[i], b.fields[i])
 	}
-	return &Board{fields: newFields, width:b.width, height:b.height, swarm:make(map[*Player][]*Field), piranhas:make(map[*Player][]*Field)}
+	return &Board{fields: newFields, width:b.width, height:b.height, swarms:make(map[*Player][]Swarm), piranhas:make(map[*Player][]*Field)}
+}
+
+// String renders the board with the row y = height-1 on top, red piranhas as
+// R, blue piranhas as B and obstructed fields as O.
+func (b *Board) String() string {
+	var sb strings.Builder
+	for y := b.height - 1; y >= 0; y-- {
+		fmt.Fprintf(&sb, "%2d ", y)
+		for x := 0; x < b.width; x++ {
+			switch b.GetField(x, y).T {
+			case FieldTypeRed:
+				sb.WriteString(" R")
+			case FieldTypeBlue:
+				sb.WriteString(" B")
+			case FieldTypeObstructed:
+				sb.WriteString(" O")
+			default:
+				sb.WriteString(" .")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("   ")
+	for x := 0; x < b.width; x++ {
+		fmt.Fprintf(&sb, "%2d", x)
+	}
+	sb.WriteString("\n")
+	return sb.String()
 }
 
 type Field struct {
@@ -148,4 +257,17 @@ func NewMove(x int, y int, direction Direction) *Move {
 	return &Move{X: x, Y: y, Direction: direction}
 }
 
+func (m *Move) String() string {
+	return fmt.Sprintf("%d %d %s", m.X, m.Y, m.Direction)
+}
+
+// FormatMoves joins the moves separated by commas.
+func FormatMoves(moves []*Move) string {
+	s := make([]string, len(moves))
+	for i, m := range moves {
+		s[i] = m.String()
+	}
+	return strings.Join(s, ", ")
+}
+
 
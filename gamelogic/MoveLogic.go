@@ -1,8 +1,19 @@
 package gamelogic
 
-import "math"
-
+import (
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// MoveLogic implements the rules of a game variant, the zero value follows
+// the official rules.
 type MoveLogic struct {
+	rules Rules
+}
+
+func NewMoveLogic(rules Rules) *MoveLogic {
+	return &MoveLogic{rules: rules}
 }
 
 func (m *MoveLogic) GetPossibleMoves(board *Board, player *Player) []*Move {
@@ -280,81 +291,160 @@ func (m *MoveLogic) ApplyMove(board *Board, move *Move) *Board {
 	return newBoard
 }
 
-func (m *MoveLogic) getSwarmHelper(board *Board, player *Player, field *Field, swarm *map[*Field]int) {
-	if _, ok := (*swarm)[field]; !ok {
-		(*swarm)[field] = 1
-		x := field.X
-		y := field.Y
-		if x > 0 && board.GetField(x-1, y).IsPiranhaOfPlayer(player) {
-			m.getSwarmHelper(board, player, board.GetField(x-1, y), swarm)
-		}
-		if x < 9 && board.GetField(x+1, y).IsPiranhaOfPlayer(player) {
-			m.getSwarmHelper(board, player, board.GetField(x+1, y), swarm)
-		}
-		if y > 0 && board.GetField(x, y-1).IsPiranhaOfPlayer(player) {
-			m.getSwarmHelper(board, player, board.GetField(x, y-1), swarm)
-		}
-		if y < 9 && board.GetField(x, y+1).IsPiranhaOfPlayer(player) {
-			m.getSwarmHelper(board, player, board.GetField(x, y+1), swarm)
-		}
-		if x > 0 && y > 0 && board.GetField(x-1, y-1).IsPiranhaOfPlayer(player) {
-			m.getSwarmHelper(board, player, board.GetField(x-1, y-1), swarm)
-		}
-		if x < 9 && y > 0 && board.GetField(x+1, y-1).IsPiranhaOfPlayer(player) {
-			m.getSwarmHelper(board, player, board.GetField(x+1, y-1), swarm)
-		}
-		if x > 0 && y < 9 && board.GetField(x-1, y+1).IsPiranhaOfPlayer(player) {
-			m.getSwarmHelper(board, player, board.GetField(x-1, y+1), swarm)
-		}
-		if x < 9 && y < 9 && board.GetField(x+1, y+1).IsPiranhaOfPlayer(player) {
-			m.getSwarmHelper(board, player, board.GetField(x+1, y+1), swarm)
+// NextState returns the state after move, which must be legal in state.
+func (m *MoveLogic) NextState(state *GameState, move *Move) *GameState {
+	next := NewGameState(m.ApplyMove(state.board, move))
+	next.Turn = state.Turn + 1
+	next.StartColor = state.StartColor
+	next.CurrentColor = state.CurrentColor.OppositeColor()
+	next.LastMove = move
+	next.Rules = state.Rules
+	return next
+}
+
+// RandomState plays up to turns random moves from a random start board of
+// the given rules, it stops early once the game is over. Red starts.
+func RandomState(r *rand.Rand, rules Rules, turns int) *GameState {
+	m := NewMoveLogic(rules)
+	state := NewGameState(NewStartBoard(r, rules))
+	state.Rules = rules
+	state.StartColor = ColorRed
+	state.CurrentColor = ColorRed
+	for state.Turn < turns {
+		if over, _, _ := m.GameOver(state); over {
+			break
 		}
+		moves := m.GetPossibleMoves(state.board, NewPlayer(state.CurrentColor))
+		state = m.NextState(state, moves[r.Intn(len(moves))])
 	}
+	return state
 }
 
-func (m *MoveLogic) GetSwarm(board *Board, player *Player) []*Field {
-	fields, ok := board.swarm[player]
-	if !ok {
-		dict := make(map[*Field]int)
-		piranhas := m.GetPiranhas(board, player)
-
-		x := 0
-		y := 0
-		count := 0
-		for count != len(piranhas) {
-			f := board.GetField(x, y)
-			_, ok := dict[f]
-			if f.IsPiranhaOfPlayer(player) && !ok {
-				swarm := make(map[*Field]int)
-				m.getSwarmHelper(board, player, f, &swarm)
-				idx := count
-				for k := range swarm {
-					dict[k] = idx
-					count++
-				}
+// Swarm is a group of connected piranhas of one player, which neighbours
+// are connected is defined by Rules.Adjacency.
+type Swarm struct {
+	Fields []*Field
+}
+
+func (s Swarm) Size() int {
+	return len(s.Fields)
+}
+
+// GetSwarms returns all swarms of the player, the largest first. Swarms of
+// equal size keep the order in which their first field appears on the board.
+func (m *MoveLogic) GetSwarms(board *Board, player *Player) []Swarm {
+	swarms, ok := board.swarms[player]
+	if ok {
+		return swarms
+	}
+
+	buffers := swarmBufferPool.Get().(*swarmBuffers)
+	defer swarmBufferPool.Put(buffers)
+	parent, index, sizes := buffers.reset(board.width * board.height)
+
+	// union-find over the field indices y*width+x, -1 marks fields without
+	// a piranha of the player
+	piranhas := m.GetPiranhas(board, player)
+	for _, f := range piranhas {
+		i := f.Y*board.width + f.X
+		parent[i] = i
+		for _, n := range m.rules.Adjacency.neighbours() {
+			x, y := f.X+n[0], f.Y+n[1]
+			if x < 0 || x >= board.width || y < 0 {
+				continue
 			}
-			x++
-			if x == 10 {
-				x = 0
-				y++
+			if j := y*board.width + x; parent[j] >= 0 {
+				union(parent, i, j)
 			}
 		}
+	}
 
-		d := make(map[int][]*Field)
-		for k, v := range dict {
-			d[v] = append(d[v], k)
+	// the root of every swarm is its first field in board order, so the
+	// root is always visited before the other fields of its swarm
+	for _, f := range piranhas {
+		i := f.Y*board.width + f.X
+		root := find(parent, i)
+		if root == i {
+			index[root] = len(sizes)
+			sizes = append(sizes, 0)
 		}
+		sizes[index[root]]++
+	}
+	buffers.sizes = sizes
+
+	// all swarms share one backing array of fields
+	fields := make([]*Field, len(piranhas))
+	swarms = make([]Swarm, len(sizes))
+	start := 0
+	for s, size := range sizes {
+		swarms[s].Fields = fields[start : start : start+size]
+		start += size
+	}
+	for _, f := range piranhas {
+		s := index[find(parent, f.Y*board.width+f.X)]
+		swarms[s].Fields = append(swarms[s].Fields, f)
+	}
 
-		maxSize := 0
-		for _, swarm := range d {
-			if len(swarm) > maxSize {
-				maxSize = len(swarm)
-				fields = swarm
-			}
+	// insertion sort is stable and there are only a few swarms
+	for i := 1; i < len(swarms); i++ {
+		for j := i; j > 0 && swarms[j].Size() > swarms[j-1].Size(); j-- {
+			swarms[j], swarms[j-1] = swarms[j-1], swarms[j]
 		}
-		board.swarm[player] = fields
 	}
-	return fields
+
+	board.swarms[player] = swarms
+	return swarms
+}
+
+// swarmBuffers are the scratch slices of GetSwarms, pooled so the swarm
+// detection only allocates its result.
+type swarmBuffers struct {
+	parent []int
+	index  []int
+	sizes  []int
+}
+
+var swarmBufferPool = sync.Pool{New: func() interface{} { return new(swarmBuffers) }}
+
+// reset prepares the buffers for a board of the given number of fields.
+func (b *swarmBuffers) reset(fields int) ([]int, []int, []int) {
+	if cap(b.parent) < fields {
+		b.parent = make([]int, fields)
+		b.index = make([]int, fields)
+	}
+	b.parent = b.parent[:fields]
+	b.index = b.index[:fields]
+	for i := range b.parent {
+		b.parent[i] = -1
+	}
+	return b.parent, b.index, b.sizes[:0]
+}
+
+func find(parent []int, i int) int {
+	for parent[i] != i {
+		parent[i] = parent[parent[i]]
+		i = parent[i]
+	}
+	return i
+}
+
+// union joins the sets of a and b, the smaller index becomes the root.
+func union(parent []int, a int, b int) {
+	a, b = find(parent, a), find(parent, b)
+	if a < b {
+		parent[b] = a
+	} else if b < a {
+		parent[a] = b
+	}
+}
+
+// GetSwarm returns the fields of the largest swarm of the player.
+func (m *MoveLogic) GetSwarm(board *Board, player *Player) []*Field {
+	swarms := m.GetSwarms(board, player)
+	if len(swarms) == 0 {
+		return nil
+	}
+	return swarms[0].Fields
 }
 
 func (m *MoveLogic) IsInSwarm(board *Board, player *Player, field *Field) bool {
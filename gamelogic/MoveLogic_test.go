@@ -0,0 +1,142 @@
+package gamelogic
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// randomBoards returns the boards of random states, every board is taken
+// after a random number of turns.
+func randomBoards(r *rand.Rand, count int) []*Board {
+	boards := make([]*Board, count)
+	for i := range boards {
+		boards[i] = RandomState(r, DefaultRules(), r.Intn(60)).board
+	}
+	return boards
+}
+
+func TestGetSwarms(t *testing.T) {
+	m := &MoveLogic{}
+	for i, board := range randomBoards(rand.New(rand.NewSource(1)), 200) {
+		for _, player := range []*Player{NewPlayer(ColorRed), NewPlayer(ColorBlue)} {
+			swarms := m.GetSwarms(board, player)
+			if a, b := len(m.GetSwarm(board, player)), len(recursiveSwarm(m, board, player)); a != b {
+				t.Fatalf("board %d: swarm size %d differs from recursive size %d\n%s", i, a, b, board)
+			}
+			fields := 0
+			for j, swarm := range swarms {
+				fields += swarm.Size()
+				if j > 0 && swarm.Size() > swarms[j-1].Size() {
+					t.Fatalf("board %d: swarm %d is larger than swarm %d\n%s", i, j, j-1, board)
+				}
+			}
+			if fields != m.GetPiranhaCount(board, player) {
+				t.Fatalf("board %d: swarms hold %d of %d piranhas\n%s", i, fields, m.GetPiranhaCount(board, player), board)
+			}
+		}
+	}
+}
+
+// BenchmarkGetSwarms compares the union-find swarm detection with the former
+// recursive implementation.
+func BenchmarkGetSwarms(b *testing.B) {
+	m := &MoveLogic{}
+	boards := randomBoards(rand.New(rand.NewSource(1)), 200)
+	players := []*Player{NewPlayer(ColorRed), NewPlayer(ColorBlue)}
+	b.Run("union-find", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			board := boards[n%len(boards)]
+			for _, player := range players {
+				delete(board.swarms, player)
+				m.GetSwarms(board, player)
+			}
+		}
+	})
+	b.Run("recursive", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			board := boards[n%len(boards)]
+			for _, player := range players {
+				recursiveSwarm(m, board, player)
+			}
+		}
+	})
+}
+
+// recursiveSwarm is the former swarm detection, kept as reference for the
+// tests. It only supports 10x10 boards.
+func recursiveSwarm(m *MoveLogic, board *Board, player *Player) []*Field {
+	var fields []*Field
+	dict := make(map[*Field]int)
+	piranhas := m.GetPiranhas(board, player)
+
+	x := 0
+	y := 0
+	count := 0
+	for count != len(piranhas) {
+		f := board.GetField(x, y)
+		_, ok := dict[f]
+		if f.IsPiranhaOfPlayer(player) && !ok {
+			swarm := make(map[*Field]int)
+			recursiveSwarmHelper(board, player, f, &swarm)
+			idx := count
+			for k := range swarm {
+				dict[k] = idx
+				count++
+			}
+		}
+		x++
+		if x == 10 {
+			x = 0
+			y++
+		}
+	}
+
+	d := make(map[int][]*Field)
+	for k, v := range dict {
+		d[v] = append(d[v], k)
+	}
+
+	maxSize := 0
+	for idx := 0; idx < len(piranhas); idx++ {
+		swarm := d[idx]
+		if len(swarm) > maxSize {
+			maxSize = len(swarm)
+			fields = swarm
+		}
+	}
+	return fields
+}
+
+func recursiveSwarmHelper(board *Board, player *Player, field *Field, swarm *map[*Field]int) {
+	if _, ok := (*swarm)[field]; !ok {
+		(*swarm)[field] = 1
+		x := field.X
+		y := field.Y
+		if x > 0 && board.GetField(x-1, y).IsPiranhaOfPlayer(player) {
+			recursiveSwarmHelper(board, player, board.GetField(x-1, y), swarm)
+		}
+		if x < 9 && board.GetField(x+1, y).IsPiranhaOfPlayer(player) {
+			recursiveSwarmHelper(board, player, board.GetField(x+1, y), swarm)
+		}
+		if y > 0 && board.GetField(x, y-1).IsPiranhaOfPlayer(player) {
+			recursiveSwarmHelper(board, player, board.GetField(x, y-1), swarm)
+		}
+		if y < 9 && board.GetField(x, y+1).IsPiranhaOfPlayer(player) {
+			recursiveSwarmHelper(board, player, board.GetField(x, y+1), swarm)
+		}
+		if x > 0 && y > 0 && board.GetField(x-1, y-1).IsPiranhaOfPlayer(player) {
+			recursiveSwarmHelper(board, player, board.GetField(x-1, y-1), swarm)
+		}
+		if x < 9 && y > 0 && board.GetField(x+1, y-1).IsPiranhaOfPlayer(player) {
+			recursiveSwarmHelper(board, player, board.GetField(x+1, y-1), swarm)
+		}
+		if x > 0 && y < 9 && board.GetField(x-1, y+1).IsPiranhaOfPlayer(player) {
+			recursiveSwarmHelper(board, player, board.GetField(x-1, y+1), swarm)
+		}
+		if x < 9 && y < 9 && board.GetField(x+1, y+1).IsPiranhaOfPlayer(player) {
+			recursiveSwarmHelper(board, player, board.GetField(x+1, y+1), swarm)
+		}
+	}
+}
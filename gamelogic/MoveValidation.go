@@ -0,0 +1,108 @@
+package gamelogic
+
+import "fmt"
+
+type MoveErrorReason int
+
+const (
+	MoveOffBoard MoveErrorReason = iota
+	MoveNoOwnPiranha
+	MoveOntoOwnPiranha
+	MoveOverOpponent
+	MoveOntoObstacle
+	MoveWrongDistance
+)
+
+func (r MoveErrorReason) String() string {
+	switch r {
+	case MoveOffBoard:
+		return "off board"
+	case MoveNoOwnPiranha:
+		return "no own piranha"
+	case MoveOntoOwnPiranha:
+		return "lands on own piranha"
+	case MoveOverOpponent:
+		return "jumps over opponent"
+	case MoveOntoObstacle:
+		return "lands on obstacle"
+	case MoveWrongDistance:
+		return "wrong distance"
+	}
+	return "unknown"
+}
+
+// MoveError describes why a move is illegal.
+type MoveError struct {
+	Move   *Move
+	Reason MoveErrorReason
+	Detail string
+}
+
+func (e *MoveError) Error() string {
+	return fmt.Sprintf("move (%d, %d) %s is illegal: %s, %s", e.Move.X, e.Move.Y, e.Move.Direction, e.Reason, e.Detail)
+}
+
+// ValidateMove checks a move of player on board, it returns a *MoveError if
+// the move is illegal and nil otherwise.
+func (m *MoveLogic) ValidateMove(board *Board, player *Player, move *Move) error {
+	if move.X < 0 || move.X >= board.width || move.Y < 0 || move.Y >= board.height {
+		return &MoveError{move, MoveOffBoard, "start field is not on the board"}
+	}
+	field := board.GetField(move.X, move.Y)
+	if !field.IsPiranhaOfPlayer(player) {
+		return &MoveError{move, MoveNoOwnPiranha, fmt.Sprintf("field (%d, %d) holds no own piranha", move.X, move.Y)}
+	}
+	distance := m.CalculateMoveDistance(board, field, move.Direction)
+	if distance <= 0 {
+		return &MoveError{move, MoveWrongDistance, fmt.Sprintf("unknown direction %d", move.Direction)}
+	}
+	target := m.GetFieldInDirection(board, move, distance)
+	if target == nil {
+		return &MoveError{move, MoveOffBoard, fmt.Sprintf("target is %d fields away", distance)}
+	}
+	for _, f := range m.getFieldsInDirection(board, move, distance) {
+		if f.IsPiranha() && !f.IsPiranhaOfPlayer(player) {
+			return &MoveError{move, MoveOverOpponent, fmt.Sprintf("opponent on (%d, %d)", f.X, f.Y)}
+		}
+	}
+	if target.IsPiranhaOfPlayer(player) {
+		return &MoveError{move, MoveOntoOwnPiranha, fmt.Sprintf("target (%d, %d)", target.X, target.Y)}
+	}
+	if target.IsObstructed() {
+		return &MoveError{move, MoveOntoObstacle, fmt.Sprintf("target (%d, %d)", target.X, target.Y)}
+	}
+	return nil
+}
+
+// ValidateTransition checks that after is the result of the move of player
+// on before. Besides the checks of ValidateMove it detects a piranha that
+// landed on another field than the move distance allows.
+func (m *MoveLogic) ValidateTransition(before *Board, after *Board, player *Player, move *Move) error {
+	if err := m.ValidateMove(before, player, move); err != nil {
+		return err
+	}
+	if before.width != after.width || before.height != after.height {
+		return fmt.Errorf("board size changed from %dx%d to %dx%d", before.width, before.height, after.width, after.height)
+	}
+	expected := m.ApplyMove(before, move)
+	var mismatch *Field
+	for y := 0; y < after.height; y++ {
+		for x := 0; x < after.width; x++ {
+			field := after.GetField(x, y)
+			if expected.GetField(x, y).T == field.T {
+				continue
+			}
+			if field.IsPiranhaOfPlayer(player) {
+				target := m.GetFieldInDirection(before, move, m.CalculateMoveDistance(before, before.GetField(move.X, move.Y), move.Direction))
+				return &MoveError{move, MoveWrongDistance, fmt.Sprintf("piranha landed on (%d, %d) instead of (%d, %d)", x, y, target.X, target.Y)}
+			}
+			if mismatch == nil {
+				mismatch = field
+			}
+		}
+	}
+	if mismatch != nil {
+		return fmt.Errorf("field (%d, %d) does not match the move (%d, %d) %s", mismatch.X, mismatch.Y, move.X, move.Y, move.Direction)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package gamelogic
+
+import "testing"
+
+// parseBoard creates a board from rows in the format of Board.String
+// without coordinates and spaces, the first row is the top one.
+func parseBoard(rows ...string) *Board {
+	height := len(rows)
+	width := len(rows[0])
+	fields := make([][]*Field, height)
+	for y := range fields {
+		fields[y] = make([]*Field, width)
+		for x := range fields[y] {
+			t := FieldTypeEmpty
+			switch rows[height-1-y][x] {
+			case 'R':
+				t = FieldTypeRed
+			case 'B':
+				t = FieldTypeBlue
+			case 'O':
+				t = FieldTypeObstructed
+			}
+			fields[y][x] = NewField(x, y, t)
+		}
+	}
+	return NewBoard(fields, width, height)
+}
+
+func TestValidateMove(t *testing.T) {
+	m := &MoveLogic{}
+	red := NewPlayer(ColorRed)
+	board := parseBoard(
+		".....",
+		"R.B.R",
+		"RO...",
+		"R.R..",
+		".B...",
+	)
+	// the piranha moving up from (0, 1) lands on (1, 4) instead of (0, 4)
+	wrongDistance := m.ApplyMove(board, NewMove(0, 1, DirectionUp))
+	wrongDistance.SetField(NewField(0, 4, FieldTypeEmpty))
+	wrongDistance.SetField(NewField(1, 4, FieldTypeRed))
+
+	tests := []struct {
+		name   string
+		move   *Move
+		after  *Board
+		legal  bool
+		reason MoveErrorReason
+	}{
+		{name: "legal", move: NewMove(0, 1, DirectionUp), legal: true},
+		{name: "legal transition", move: NewMove(0, 1, DirectionUp), after: m.ApplyMove(board, NewMove(0, 1, DirectionUp)), legal: true},
+		{name: "off board", move: NewMove(0, 3, DirectionUp), reason: MoveOffBoard},
+		{name: "no own piranha", move: NewMove(1, 0, DirectionUp), reason: MoveNoOwnPiranha},
+		{name: "onto own piranha", move: NewMove(0, 1, DirectionRight), reason: MoveOntoOwnPiranha},
+		{name: "over opponent", move: NewMove(4, 3, DirectionLeft), reason: MoveOverOpponent},
+		{name: "onto obstacle", move: NewMove(0, 2, DirectionRight), reason: MoveOntoObstacle},
+		{name: "wrong distance", move: NewMove(0, 1, DirectionUp), after: wrongDistance, reason: MoveWrongDistance},
+	}
+	for _, test := range tests {
+		var err error
+		if test.after != nil {
+			err = m.ValidateTransition(board, test.after, red, test.move)
+		} else {
+			err = m.ValidateMove(board, red, test.move)
+		}
+		if test.legal {
+			if err != nil {
+				t.Errorf("%s: move %v is illegal: %v", test.name, test.move, err)
+			}
+			continue
+		}
+		moveErr, ok := err.(*MoveError)
+		if !ok {
+			t.Errorf("%s: move %v returned %v, expected a move error", test.name, test.move, err)
+			continue
+		}
+		if moveErr.Reason != test.reason {
+			t.Errorf("%s: move %v is illegal: %s, expected %s", test.name, test.move, moveErr.Reason, test.reason)
+		}
+	}
+}
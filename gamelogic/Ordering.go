@@ -0,0 +1,96 @@
+package gamelogic
+
+import "sort"
+
+// maxPly bounds the search depth.
+const maxPly = 64
+
+const (
+	scoreHashMove = 1 << 30
+	scoreCapture  = 1 << 29
+	scoreKiller   = 1 << 28
+)
+
+type orderedMove struct {
+	move    *Move
+	target  *Field
+	score   int
+	capture bool
+}
+
+// moveOrdering remembers which moves caused cutoffs. Killer moves are the
+// last two quiet moves causing a cutoff on a ply, the history counts
+// cutoffs of a move from a field in a direction anywhere in the tree.
+type moveOrdering struct {
+	killers [maxPly][2]*Move
+	history [MaxBoardSize * MaxBoardSize][8]int
+}
+
+// reset prepares a new search. Killers only apply to the tree they were
+// found in, the history is kept with less weight.
+func (o *moveOrdering) reset() {
+	o.killers = [maxPly][2]*Move{}
+	for i := range o.history {
+		for d := range o.history[i] {
+			o.history[i][d] /= 2
+		}
+	}
+}
+
+func (o *moveOrdering) recordCutoff(board *Board, move *Move, ply int, depth int) {
+	if !sameMove(o.killers[ply][0], move) {
+		o.killers[ply][1] = o.killers[ply][0]
+		o.killers[ply][0] = move
+	}
+	o.history[move.Y*board.width+move.X][move.Direction] += depth * depth
+}
+
+// orderMoves returns the possible moves of player, the stored hash move
+// first, then captures, killer moves and all other moves by their history.
+// Only captures in the largest swarm of opponent come before the killers,
+// capturing a piranha outside of it rather helps opponent to connect.
+func (c *Controller) orderMoves(board *Board, player *Player, opponent *Player, hashMove *Move, ply int) []orderedMove {
+	possibleMoves := c.moveLogic.GetPossibleMoves(board, player)
+	moves := make([]orderedMove, len(possibleMoves))
+	for i, move := range possibleMoves {
+		target := c.moveLogic.GetFieldInDirection(board, move, c.moveLogic.CalculateMoveDistance(board, board.GetField(move.X, move.Y), move.Direction))
+		moves[i] = orderedMove{move: move, target: target, capture: target.IsPiranhaOfPlayer(opponent)}
+	}
+	if c.noOrdering {
+		return moves
+	}
+
+	swarm := c.moveLogic.GetSwarm(board, opponent)
+	for i := range moves {
+		m := &moves[i]
+		switch {
+		case sameMove(m.move, hashMove):
+			m.score = scoreHashMove
+		case m.capture && inSwarm(swarm, m.target):
+			m.score = scoreCapture
+		case ply < maxPly && sameMove(m.move, c.ordering.killers[ply][0]):
+			m.score = scoreKiller + 1
+		case ply < maxPly && sameMove(m.move, c.ordering.killers[ply][1]):
+			m.score = scoreKiller
+		default:
+			m.score = c.ordering.history[m.move.Y*board.width+m.move.X][m.move.Direction]
+		}
+	}
+	sort.SliceStable(moves, func(l, r int) bool {
+		return moves[l].score > moves[r].score
+	})
+	return moves
+}
+
+func sameMove(a *Move, b *Move) bool {
+	return a != nil && b != nil && *a == *b
+}
+
+func inSwarm(swarm []*Field, field *Field) bool {
+	for _, f := range swarm {
+		if f.X == field.X && f.Y == field.Y {
+			return true
+		}
+	}
+	return false
+}
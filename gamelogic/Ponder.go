@@ -0,0 +1,143 @@
+package gamelogic
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime/debug"
+)
+
+// ponder is a search running in the background while the opponent thinks.
+// It searches the state expected after the own move and the predicted reply
+// of the opponent. The search goroutine only touches the search data of the
+// controller, everything else is left to the caller until done is closed.
+type ponder struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	base   *GameState
+	own    *Move
+	reply  *Move
+	state  *GameState
+	// next is the state after the own move, it may arrive while pondering
+	next   *GameState
+	result ponderResult
+}
+
+// ponderResult is the outcome of the last completed iteration of a ponder
+// search, see search for how it is resumed.
+type ponderResult struct {
+	turn      int
+	hash      uint64
+	move      *Move
+	heuristic float64
+	depth     int
+	pv        []*Move
+}
+
+// Ponder starts searching the state after move and the predicted reply of the
+// opponent in the background. The prediction is the reply in the principal
+// variation or the best move in the transposition table. It returns false if
+// there is nothing to ponder. Until the next UpdateState or StopPondering the
+// controller must not be used otherwise, all exported methods working on the
+// state stop pondering first.
+func (c *Controller) Ponder(move *Move) bool {
+	c.StopPondering()
+	if !c.readyToPlay() || c.moveLogic.ValidateMove(c.state.board, c.ownPlayer, move) != nil {
+		return false
+	}
+	afterMove := c.moveLogic.NextState(c.state, move)
+	if over, _, _ := c.moveLogic.GameOver(afterMove); over {
+		return false
+	}
+	reply := c.predictReply(move, afterMove.board)
+	if reply == nil {
+		return false
+	}
+	predicted := c.moveLogic.NextState(afterMove, reply)
+	if over, _, _ := c.moveLogic.GameOver(predicted); over {
+		return false
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &ponder{cancel: cancel, done: make(chan struct{}), base: c.state, own: move, reply: reply, state: predicted}
+	p.result.turn = predicted.Turn
+	p.result.hash = positionHash(predicted.board, c.ownPlayer, predicted.Turn)
+	c.ponder = p
+	c.resume = nil
+	c.state = predicted
+	go func() {
+		defer close(p.done)
+		// a failing search must not take the client down while the opponent
+		// thinks, the next search starts over without the result
+		defer func() {
+			if r := recover(); r != nil {
+				fmt.Fprintf(os.Stderr, "ponder search failed: panic: %v\n%s", r, debug.Stack())
+			}
+		}()
+		p.result.move, p.result.heuristic = c.search(ctx)
+		p.result.depth = c.stats.Depth
+		p.result.pv = c.pv
+	}()
+	return true
+}
+
+// IsPondering tells whether a ponder search was started and not stopped yet,
+// it may have finished already.
+func (c *Controller) IsPondering() bool {
+	return c.ponder != nil
+}
+
+// StopPondering aborts the ponder search and waits until it finished. The
+// result is dropped.
+func (c *Controller) StopPondering() {
+	c.stopPondering()
+}
+
+func (c *Controller) stopPondering() *ponder {
+	p := c.ponder
+	if p == nil {
+		return nil
+	}
+	p.cancel()
+	<-p.done
+	c.ponder = nil
+	c.state = p.base
+	if p.next != nil {
+		c.state = p.next
+	}
+	return p
+}
+
+// updatePondering handles a new state while pondering. The state after the
+// own move does not stop pondering, the state after the predicted reply
+// stops it and keeps the result for the next search. It returns true when
+// the state was taken over without stopping.
+func (c *Controller) updatePondering(newstate *GameState) bool {
+	p := c.ponder
+	if p == nil {
+		return false
+	}
+	if p.next == nil && newstate.Turn == p.base.Turn+1 && sameMove(newstate.LastMove, p.own) && newstate.Rules == p.base.Rules {
+		p.next = newstate
+		return true
+	}
+	c.stopPondering()
+	if p.result.depth > 0 && newstate.Turn == p.state.Turn && sameMove(newstate.LastMove, p.reply) &&
+		newstate.board.Hash() == p.state.board.Hash() {
+		c.resume = &p.result
+	}
+	return false
+}
+
+func (c *Controller) predictReply(move *Move, board *Board) *Move {
+	var reply *Move
+	if len(c.pv) >= 2 && sameMove(c.pv[0], move) {
+		reply = c.pv[1]
+	} else {
+		reply = c.tt.BestMove(positionHash(board, c.foreignPlayer, c.state.Turn+1))
+	}
+	if reply == nil || c.moveLogic.ValidateMove(board, c.foreignPlayer, reply) != nil {
+		return nil
+	}
+	return reply
+}
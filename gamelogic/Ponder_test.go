@@ -0,0 +1,75 @@
+package gamelogic
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+)
+
+// ponderController returns a controller for red in a fresh game which
+// searched the start position, so it has a principal variation to ponder.
+func ponderController(t *testing.T) (*Controller, *Move) {
+	state := NewGameState(NewStartBoard(rand.New(rand.NewSource(1)), DefaultRules()))
+	state.StartColor = ColorRed
+	state.CurrentColor = ColorRed
+	c := NewController(1 << 20)
+	c.SetMaxDepth(2)
+	c.SetPlayer(ColorRed)
+	c.UpdateState(state)
+	move, _, err := c.Evaluate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, move
+}
+
+// TestPonder runs the ponder search against the state updates of a game,
+// it is meant to run with the race detector.
+func TestPonder(t *testing.T) {
+	tests := []struct {
+		name string
+		hit  bool
+	}{
+		{name: "hit", hit: true},
+		{name: "miss", hit: false},
+	}
+	for _, test := range tests {
+		c, move := ponderController(t)
+		base := c.state
+		if !c.Ponder(move) {
+			t.Fatalf("%s: nothing to ponder after %v", test.name, move)
+		}
+		p := c.ponder
+		afterMove := c.moveLogic.NextState(base, move)
+		if err := c.UpdateState(afterMove); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !c.IsPondering() {
+			t.Fatalf("%s: the state after the own move stopped pondering", test.name)
+		}
+
+		// wait for the search, so the outcome does not depend on timing
+		<-p.done
+		reply := p.reply
+		if !test.hit {
+			for _, m := range c.moveLogic.GetPossibleMoves(afterMove.board, c.foreignPlayer) {
+				if !sameMove(m, p.reply) {
+					reply = m
+					break
+				}
+			}
+		}
+		if err := c.UpdateState(c.moveLogic.NextState(afterMove, reply)); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if c.IsPondering() {
+			t.Fatalf("%s: the reply did not stop pondering", test.name)
+		}
+		if _, _, err := c.Evaluate(context.Background()); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if hit := c.Stats().PonderDepth > 0; hit != test.hit {
+			t.Errorf("%s: search resumed after depth %d", test.name, c.Stats().PonderDepth)
+		}
+	}
+}
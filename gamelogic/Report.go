@@ -0,0 +1,89 @@
+package gamelogic
+
+import "time"
+
+// MoveReport describes how the last move was found. It is meant to be logged
+// as one JSON object per move and aggregated over many games.
+type MoveReport struct {
+	RoomID          string   `json:"room"`
+	Turn            int      `json:"turn"`
+	Color           string   `json:"color"`
+	Source          string   `json:"source"`
+	Move            string   `json:"move"`
+	Score           float64  `json:"score"`
+	PV              []string `json:"pv"`
+	LegalMoves      int      `json:"legalMoves"`
+	Depth           int      `json:"depth"`
+	PonderDepth     int      `json:"ponderDepth,omitempty"`
+	Nodes           int      `json:"nodes"`
+	QuiescenceNodes int      `json:"quiescenceNodes"`
+	NPS             float64  `json:"nps"`
+	TTHitRate       float64  `json:"ttHitRate"`
+	Cutoffs         int      `json:"cutoffs"`
+	CutoffRate      float64  `json:"cutoffRate"`
+	TimeUsedMs      float64  `json:"timeUsedMs"`
+	TimeBudgetMs    float64  `json:"timeBudgetMs,omitempty"`
+}
+
+// Sources of a move in a MoveReport.
+const (
+	SourceSearch  = "search"
+	SourceBook    = "book"
+	SourceEndgame = "endgame"
+)
+
+// Report returns the report of the last evaluation.
+func (c *Controller) Report() MoveReport {
+	return c.report
+}
+
+func (c *Controller) newReport(move *Move, heuristic float64, legalMoves int, elapsed time.Duration) MoveReport {
+	stats := c.stats
+	report := MoveReport{
+		RoomID:          c.roomID,
+		Turn:            c.state.Turn,
+		Color:           colorString(c.ownPlayer.color),
+		Source:          SourceSearch,
+		Score:           heuristic,
+		PV:              []string{},
+		LegalMoves:      legalMoves,
+		Depth:           stats.Depth,
+		PonderDepth:     stats.PonderDepth,
+		Nodes:           stats.Nodes,
+		QuiescenceNodes: stats.QuiescenceNodes,
+		Cutoffs:         stats.Cutoffs,
+		CutoffRate:      stats.CutoffRate(),
+		TimeUsedMs:      durationMs(elapsed),
+		TimeBudgetMs:    durationMs(stats.TimeBudget),
+	}
+	switch {
+	case c.inBook:
+		report.Source = SourceBook
+	case c.endgame.Outcome != OutcomeUnknown:
+		report.Source = SourceEndgame
+	}
+	if move != nil {
+		report.Move = move.String()
+	}
+	for _, m := range c.pv {
+		report.PV = append(report.PV, m.String())
+	}
+	if elapsed > 0 {
+		report.NPS = float64(stats.Nodes) / elapsed.Seconds()
+	}
+	if stats.TTProbes > 0 {
+		report.TTHitRate = float64(stats.TTHits) / float64(stats.TTProbes)
+	}
+	return report
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func colorString(c Color) string {
+	if c == ColorRed {
+		return "red"
+	}
+	return "blue"
+}
@@ -0,0 +1,131 @@
+package gamelogic
+
+import "fmt"
+
+// Adjacency defines which piranhas are connected to a swarm.
+type Adjacency int
+
+const (
+	// AdjacencyDiagonal connects piranhas horizontally, vertically and
+	// diagonally, as in the official rules.
+	AdjacencyDiagonal Adjacency = 0
+	// AdjacencyOrthogonal only connects piranhas horizontally and vertically.
+	AdjacencyOrthogonal Adjacency = 1
+)
+
+func (a Adjacency) String() string {
+	if a == AdjacencyOrthogonal {
+		return "orthogonal"
+	}
+	return "diagonal"
+}
+
+func ParseAdjacency(s string) (Adjacency, error) {
+	switch s {
+	case "diagonal":
+		return AdjacencyDiagonal, nil
+	case "orthogonal":
+		return AdjacencyOrthogonal, nil
+	}
+	return AdjacencyDiagonal, fmt.Errorf("unknown adjacency %q, expected diagonal or orthogonal", s)
+}
+
+// neighbours returns the offsets of the neighbours left of or below a field,
+// which are enough to visit every connection once when scanning the board
+// row by row.
+func (a Adjacency) neighbours() [][2]int {
+	if a == AdjacencyOrthogonal {
+		return orthogonalNeighbours
+	}
+	return diagonalNeighbours
+}
+
+var (
+	orthogonalNeighbours = [][2]int{{-1, 0}, {0, -1}}
+	diagonalNeighbours   = [][2]int{{-1, 0}, {-1, -1}, {0, -1}, {1, -1}}
+)
+
+// Rules describes a game variant. The board is Size x Size fields, the game
+// ends after TurnLimit turns and Obstacles obstructed fields are placed in
+// the inner area of the board.
+type Rules struct {
+	Size      int
+	TurnLimit int
+	Obstacles int
+	Adjacency Adjacency
+}
+
+// DefaultRules returns the official rules of 2019.
+func DefaultRules() Rules {
+	return Rules{Size: 10, TurnLimit: 60, Obstacles: 2, Adjacency: AdjacencyDiagonal}
+}
+
+// MaxBoardSize is limited by the zobrist keys used for hashing boards.
+const MaxBoardSize = 16
+
+func (r Rules) Validate() error {
+	if r.Size < 4 || r.Size > MaxBoardSize {
+		return fmt.Errorf("board size %d is not between 4 and %d", r.Size, MaxBoardSize)
+	}
+	if r.TurnLimit < 2 || r.TurnLimit%2 != 0 {
+		return fmt.Errorf("turn limit %d is not a positive even number", r.TurnLimit)
+	}
+	if r.Obstacles < 0 || r.Obstacles > r.maxObstacles() {
+		return fmt.Errorf("%d obstacles do not fit on a %dx%d board, at most %d are possible", r.Obstacles, r.Size, r.Size, r.maxObstacles())
+	}
+	if r.Adjacency != AdjacencyDiagonal && r.Adjacency != AdjacencyOrthogonal {
+		return fmt.Errorf("unknown adjacency %d", r.Adjacency)
+	}
+	return nil
+}
+
+// maxObstacles returns how many obstacles fit into the inner area without
+// sharing a row, column or diagonal, like queens on a chess board.
+func (r Rules) maxObstacles() int {
+	inner := r.Size - 4
+	switch {
+	case inner <= 0:
+		return 0
+	case inner <= 2:
+		return 1
+	case inner == 3:
+		return 2
+	}
+	return inner
+}
+
+// GameOver decides whether the game ends in the given state. The game is
+// checked at the end of every round: a connected swarm ends the game, and
+// after the last turn or when the player to move is stuck the larger swarm
+// wins.
+func (m *MoveLogic) GameOver(state *GameState) (over bool, draw bool, winner Color) {
+	board := state.board
+	red, blue := NewPlayer(ColorRed), NewPlayer(ColorBlue)
+	current := red
+	if state.CurrentColor == ColorBlue {
+		current = blue
+	}
+	canMove := len(m.GetPossibleMoves(board, current)) > 0
+	if state.Turn%2 != 0 && canMove {
+		return false, false, ColorRed
+	}
+	redWon := m.HasPlayerWon(board, red)
+	blueWon := m.HasPlayerWon(board, blue)
+	if !redWon && !blueWon && state.Turn < state.Rules.TurnLimit && canMove {
+		return false, false, ColorRed
+	}
+
+	redSize := m.CalculateSwarmSize(board, red)
+	blueSize := m.CalculateSwarmSize(board, blue)
+	switch {
+	case redWon && !blueWon:
+		return true, false, ColorRed
+	case blueWon && !redWon:
+		return true, false, ColorBlue
+	case redSize > blueSize:
+		return true, false, ColorRed
+	case blueSize > redSize:
+		return true, false, ColorBlue
+	}
+	return true, true, ColorRed
+}
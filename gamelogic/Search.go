@@ -0,0 +1,515 @@
+package gamelogic
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	// winScore rates a won game, wins found earlier in the search are rated
+	// slightly higher so the shortest win is preferred.
+	winScore = 10000.0
+	infinity = math.MaxFloat64
+
+	maxQuiescenceDepth = 4
+
+	// nullWindow is the width of the windows proving that a move is not
+	// better than the best one found so far.
+	nullWindow = 0.001
+	// aspirationWindow is the initial distance of the window bounds from
+	// the heuristic of the previous iteration.
+	aspirationWindow    = 0.5
+	maxAspirationWindow = 100.0
+)
+
+// SearchStats counts the work done by the last search. Cutoffs caused by the
+// first searched move show how well the moves were ordered.
+type SearchStats struct {
+	Depth            int
+	Nodes            int
+	QuiescenceNodes  int
+	Cutoffs          int
+	FirstMoveCutoffs int
+	Researches       int
+	Reductions       int
+	FutilityPrunes   int
+	TTProbes         int
+	TTHits           int
+	// PonderDepth is the depth taken over from pondering, 0 without a
+	// ponder hit
+	PonderDepth int
+	// TimeBudget is the time the time manager granted in the end
+	TimeBudget time.Duration
+}
+
+func (s SearchStats) CutoffRate() float64 {
+	if s.Cutoffs == 0 {
+		return 0
+	}
+	return float64(s.FirstMoveCutoffs) / float64(s.Cutoffs)
+}
+
+func (c *Controller) Stats() SearchStats {
+	return c.stats
+}
+
+// SearchOptions configures the pruning of the search. Late moves, which are
+// neither captures nor hash or killer moves, are searched LMRReduction plies
+// shallower once LMRMinMoves moves were searched in a node with at least
+// LMRMinDepth remaining plies. Within FutilityDepth plies of the leaves quiet
+// moves are skipped when the static heuristic plus FutilityMargin per
+// remaining ply cannot reach alpha. A zero LMRReduction or FutilityDepth
+// disables the respective pruning. EndgamePiranhas and EndgameMovesToConnect
+// decide when the endgame solver runs before the search, see IsEndgame.
+type SearchOptions struct {
+	LMRMinDepth           int
+	LMRMinMoves           int
+	LMRReduction          int
+	FutilityDepth         int
+	FutilityMargin        float64
+	EndgamePiranhas       int
+	EndgameMovesToConnect int
+}
+
+func DefaultSearchOptions() SearchOptions {
+	return SearchOptions{LMRMinDepth: 3, LMRMinMoves: 4, LMRReduction: 1, FutilityDepth: 2, FutilityMargin: 3, EndgamePiranhas: 4, EndgameMovesToConnect: 1}
+}
+
+func (c *Controller) SetSearchOptions(options SearchOptions) {
+	c.options = options
+}
+
+// SetMaxDepth limits the search to the given depth, 0 searches until the
+// end of the game or until the search is cancelled.
+func (c *Controller) SetMaxDepth(depth int) {
+	c.maxDepth = depth
+}
+
+// SetMoveOrdering enables or disables move ordering, without it moves are
+// searched in the order they are generated.
+func (c *Controller) SetMoveOrdering(enabled bool) {
+	c.noOrdering = !enabled
+}
+
+// search runs an iterative deepening alpha-beta search for the own player.
+// Every iteration starts with a narrow window around the heuristic of the
+// previous one, which is widened when the result falls outside. Iterations
+// are discarded when ctx is done before they finish, if not even the first
+// one finished the first legal move is returned. After a ponder hit the
+// search continues with the iteration following the last one completed
+// while pondering.
+func (c *Controller) search(ctx context.Context) (*Move, float64) {
+	c.stats = SearchStats{}
+	c.ordering.reset()
+	c.pv = nil
+	resume := c.resume
+	c.resume = nil
+	c.trace.reset()
+
+	maxDepth := c.state.Rules.TurnLimit - c.state.Turn
+	if maxDepth < 1 {
+		maxDepth = 1
+	}
+	if maxDepth > maxPly {
+		maxDepth = maxPly
+	}
+	if c.maxDepth > 0 && c.maxDepth < maxDepth {
+		maxDepth = c.maxDepth
+	}
+
+	var bestMove *Move
+	bestHeuristic := 0.0
+	start := 1
+	if resume != nil && resume.turn == c.state.Turn && resume.hash == positionHash(c.state.board, c.ownPlayer, c.state.Turn) {
+		bestMove, bestHeuristic = resume.move, resume.heuristic
+		c.stats.Depth = resume.depth
+		c.stats.PonderDepth = resume.depth
+		c.pv = resume.pv
+		start = resume.depth + 1
+		if math.Abs(bestHeuristic) > winScore-float64(maxPly) {
+			start = maxDepth + 1
+		}
+	}
+	for depth := start; depth <= maxDepth; depth++ {
+		searchCtx := ctx
+		cancel := func() {}
+		if depth > 1 && c.clock != nil {
+			if !c.clock.startIteration() {
+				break
+			}
+			searchCtx, cancel = c.clock.iterationContext(ctx)
+		}
+
+		alpha, beta := -infinity, infinity
+		delta := aspirationWindow
+		if depth > 1 && math.Abs(bestHeuristic) < winScore-float64(maxPly) {
+			alpha, beta = bestHeuristic-delta, bestHeuristic+delta
+		}
+		var move *Move
+		var heuristic float64
+		ok := true
+		for {
+			move, heuristic, ok = c.searchRoot(searchCtx, depth, alpha, beta)
+			if !ok {
+				break
+			}
+			if heuristic <= alpha {
+				delta *= 4
+				alpha = widen(heuristic-delta, -infinity, delta)
+			} else if heuristic >= beta {
+				delta *= 4
+				beta = widen(heuristic+delta, infinity, delta)
+			} else {
+				break
+			}
+			c.stats.Researches++
+		}
+		cancel()
+		if !ok {
+			break
+		}
+		c.trace.commit()
+
+		if c.clock != nil && bestMove != nil && !sameMove(move, bestMove) {
+			c.clock.unstable()
+		}
+		bestMove = move
+		bestHeuristic = heuristic
+		c.stats.Depth = depth
+		c.pv = append([]*Move(nil), c.pvTable[0]...)
+		if math.Abs(heuristic) > winScore-float64(maxPly) {
+			// the outcome of the game is certain
+			break
+		}
+	}
+	if bestMove == nil {
+		// the time is up before a single iteration finished
+		if moves := c.moveLogic.GetPossibleMoves(c.state.board, c.ownPlayer); len(moves) > 0 {
+			bestMove = moves[0]
+			c.pv = []*Move{bestMove}
+		}
+	}
+	if c.clock != nil {
+		c.stats.TimeBudget = c.clock.budget
+	}
+	return bestMove, bestHeuristic
+}
+
+// widen returns bound, or limit once the window grew too large to be of use.
+func widen(bound float64, limit float64, delta float64) float64 {
+	if delta > maxAspirationWindow {
+		return limit
+	}
+	return bound
+}
+
+func (c *Controller) searchRoot(ctx context.Context, depth int, alpha float64, beta float64) (*Move, float64, bool) {
+	board := c.state.board
+	hash := positionHash(board, c.ownPlayer, c.state.Turn)
+	moves := c.orderMoves(board, c.ownPlayer, c.foreignPlayer, c.tt.BestMove(hash), 0)
+	c.pvTable[0] = c.pvTable[0][:0]
+
+	alphaOrig := alpha
+	var bestMove *Move
+	best := -infinity
+	c.trace.start(depth, alpha, beta)
+	for i, m := range moves {
+		child := c.moveLogic.ApplyMove(board, m.move)
+		node := c.trace.enter(1, m.move, depth-1, alpha, beta)
+		heuristic := c.searchChild(ctx, child, c.state.Turn+1, depth-1, 1, i == 0, alpha, beta, c.foreignPlayer, c.ownPlayer)
+		c.trace.leave(node, heuristic)
+		if ctx.Err() != nil {
+			return nil, 0, false
+		}
+		if bestMove == nil || heuristic > best {
+			best = heuristic
+			bestMove = m.move
+		}
+		if heuristic > alpha {
+			alpha = heuristic
+			c.updatePV(0, m.move)
+		}
+		if alpha >= beta {
+			node.note("cutoff")
+			break
+		}
+	}
+	c.trace.finish(best)
+	if len(c.pvTable[0]) == 0 {
+		// every move failed low, the best of them is only a guess
+		c.pvTable[0] = append(c.pvTable[0], bestMove)
+	}
+	c.tt.Store(hash, depth, 0, best, boundOf(best, alphaOrig, beta), bestMove)
+	return bestMove, best, true
+}
+
+// searchChild searches the position after a move of opponent from the view
+// of opponent. Only the first move is searched with the full window, all
+// others with a null window proving they are not better, and only if that
+// fails they are searched again with the full window.
+func (c *Controller) searchChild(ctx context.Context, board *Board, turn int, depth int, ply int, first bool, alpha float64, beta float64, player *Player, opponent *Player) float64 {
+	if first {
+		return -c.alphaBeta(ctx, board, turn, depth, ply, -beta, -alpha, player, opponent)
+	}
+	heuristic := -c.alphaBeta(ctx, board, turn, depth, ply, -alpha-nullWindow, -alpha, player, opponent)
+	if heuristic > alpha && heuristic < beta && ctx.Err() == nil {
+		c.stats.Researches++
+		c.trace.research(ply, "re-search")
+		heuristic = -c.alphaBeta(ctx, board, turn, depth, ply, -beta, -alpha, player, opponent)
+	}
+	return heuristic
+}
+
+// alphaBeta returns the heuristic of board from the view of player, who is
+// to move in the given turn. The result is only meaningful if ctx is not
+// done afterwards.
+func (c *Controller) alphaBeta(ctx context.Context, board *Board, turn int, depth int, ply int, alpha float64, beta float64, player *Player, opponent *Player) float64 {
+	c.stats.Nodes++
+	c.pvTable[ply] = c.pvTable[ply][:0]
+	if over, heuristic := c.gameOver(board, turn, ply, player, opponent); over {
+		c.trace.note(ply, "game over")
+		return heuristic
+	}
+	if depth == 0 || ply >= maxPly {
+		c.trace.note(ply, "quiescence")
+		return c.quiescence(ctx, board, turn, ply, maxQuiescenceDepth, alpha, beta, player, opponent)
+	}
+	if ctx.Err() != nil {
+		return 0
+	}
+
+	hash := positionHash(board, player, turn)
+	heuristic, bound, hashMove, ok := c.tt.Lookup(hash, depth, ply)
+	c.stats.TTProbes++
+	if ok {
+		c.stats.TTHits++
+		if bound == BoundExact || bound == BoundLower && heuristic >= beta || bound == BoundUpper && heuristic <= alpha {
+			c.trace.note(ply, "tt "+bound.String())
+			return heuristic
+		}
+	} else {
+		hashMove = c.tt.BestMove(hash)
+	}
+
+	moves := c.orderMoves(board, player, opponent, hashMove, ply)
+	if len(moves) == 0 {
+		// a player who cannot move ends the game
+		c.trace.note(ply, "no moves")
+		return c.finalHeuristic(board, ply, player, opponent)
+	}
+
+	futile := false
+	if c.options.FutilityDepth > 0 && depth <= c.options.FutilityDepth && math.Abs(alpha) < winScore-float64(maxPly) {
+		futile = c.evaluateBoard(board, player, opponent)+c.options.FutilityMargin*float64(depth) <= alpha
+	}
+
+	alphaOrig := alpha
+	best := -infinity
+	var bestMove *Move
+	for i, m := range moves {
+		quiet := !m.capture && m.score < scoreKiller
+		if futile && i > 0 && quiet {
+			c.stats.FutilityPrunes++
+			c.trace.skip(ply+1, m.move, depth-1, "futility")
+			continue
+		}
+		child := c.moveLogic.ApplyMove(board, m.move)
+		var heuristic float64
+		node := c.trace.enter(ply+1, m.move, depth-1, alpha, beta)
+		if c.options.LMRReduction > 0 && quiet && i >= c.options.LMRMinMoves && depth >= c.options.LMRMinDepth {
+			// a reduced null window search, only if the move turns out
+			// better than expected it is searched to the full depth
+			c.stats.Reductions++
+			reduced := depth - 1 - c.options.LMRReduction
+			if reduced < 0 {
+				reduced = 0
+			}
+			node.note(fmt.Sprintf("reduced to depth %d", reduced))
+			heuristic = -c.alphaBeta(ctx, child, turn+1, reduced, ply+1, -alpha-nullWindow, -alpha, opponent, player)
+			if heuristic > alpha && ctx.Err() == nil {
+				c.trace.research(ply+1, "re-search")
+				heuristic = c.searchChild(ctx, child, turn+1, depth-1, ply+1, false, alpha, beta, opponent, player)
+			}
+		} else {
+			heuristic = c.searchChild(ctx, child, turn+1, depth-1, ply+1, i == 0, alpha, beta, opponent, player)
+		}
+		c.trace.leave(node, heuristic)
+		if ctx.Err() != nil {
+			return 0
+		}
+		if heuristic > best {
+			best = heuristic
+			bestMove = m.move
+		}
+		if heuristic > alpha {
+			alpha = heuristic
+			c.updatePV(ply, m.move)
+		}
+		if alpha >= beta {
+			node.note("cutoff")
+			c.stats.Cutoffs++
+			if i == 0 {
+				c.stats.FirstMoveCutoffs++
+			}
+			if !m.capture {
+				c.ordering.recordCutoff(board, m.move, ply, depth)
+			}
+			break
+		}
+	}
+
+	c.tt.Store(hash, depth, ply, best, boundOf(best, alphaOrig, beta), bestMove)
+	return best
+}
+
+func boundOf(heuristic float64, alpha float64, beta float64) Bound {
+	if heuristic <= alpha {
+		return BoundUpper
+	}
+	if heuristic >= beta {
+		return BoundLower
+	}
+	return BoundExact
+}
+
+// updatePV sets the principal variation of ply to move followed by the
+// principal variation of the next ply.
+func (c *Controller) updatePV(ply int, move *Move) {
+	c.pvTable[ply] = append(append(c.pvTable[ply][:0], move), c.pvTable[ply+1]...)
+}
+
+// PrincipalVariation returns the sequence of moves the last search expects
+// to be played, starting with the own best move.
+func (c *Controller) PrincipalVariation() []*Move {
+	return c.pv
+}
+
+// quiescence continues the search past the nominal depth with captures and
+// moves completing the swarm, so positions in the middle of an exchange are
+// not evaluated. The player may also keep the static heuristic instead of
+// making any of these moves (stand pat). As captures are frequent, at most
+// depth further plies are searched.
+func (c *Controller) quiescence(ctx context.Context, board *Board, turn int, ply int, depth int, alpha float64, beta float64, player *Player, opponent *Player) float64 {
+	c.pvTable[ply] = c.pvTable[ply][:0]
+	standPat := c.evaluateBoard(board, player, opponent)
+	if depth == 0 || ply >= maxPly || standPat >= beta {
+		c.trace.note(ply, "stand pat")
+		return standPat
+	}
+	if standPat > alpha {
+		alpha = standPat
+	}
+	if ctx.Err() != nil {
+		return 0
+	}
+
+	best := standPat
+	for _, m := range c.tacticalMoves(board, player, opponent) {
+		c.stats.Nodes++
+		c.stats.QuiescenceNodes++
+		var heuristic float64
+		node := c.trace.enter(ply+1, m.move, 0, alpha, beta)
+		if over, h := c.gameOver(m.board, turn+1, ply+1, opponent, player); over {
+			node.note("game over")
+			heuristic = -h
+		} else {
+			heuristic = -c.quiescence(ctx, m.board, turn+1, ply+1, depth-1, -beta, -alpha, opponent, player)
+		}
+		c.trace.leave(node, heuristic)
+		if ctx.Err() != nil {
+			return 0
+		}
+		if heuristic > best {
+			best = heuristic
+		}
+		if heuristic > alpha {
+			alpha = heuristic
+		}
+		if alpha >= beta {
+			break
+		}
+	}
+	return best
+}
+
+type tacticalMove struct {
+	move  *Move
+	board *Board
+}
+
+// tacticalMoves returns the captures of player followed by the moves which
+// connect all piranhas of player to one swarm.
+func (c *Controller) tacticalMoves(board *Board, player *Player, opponent *Player) []tacticalMove {
+	// the target of a move touches at most four otherwise separated swarms,
+	// the moved piranha may be a fifth swarm on its own, so with more swarms
+	// no move can complete the swarm
+	canComplete := len(c.moveLogic.GetSwarms(board, player)) <= 5
+
+	var captures, completing []tacticalMove
+	for _, move := range c.moveLogic.GetPossibleMoves(board, player) {
+		target := c.moveLogic.GetFieldInDirection(board, move, c.moveLogic.CalculateMoveDistance(board, board.GetField(move.X, move.Y), move.Direction))
+		capture := target.IsPiranhaOfPlayer(opponent)
+		if !capture && !canComplete {
+			continue
+		}
+		child := c.moveLogic.ApplyMove(board, move)
+		if capture {
+			captures = append(captures, tacticalMove{move, child})
+		} else if c.moveLogic.HasPlayerWon(child, player) {
+			completing = append(completing, tacticalMove{move, child})
+		}
+	}
+	return append(captures, completing...)
+}
+
+// gameOver checks the end of the game, which is only decided at the end of
+// a round, when the player to move is red again.
+func (c *Controller) gameOver(board *Board, turn int, ply int, player *Player, opponent *Player) (bool, float64) {
+	if turn%2 != 0 {
+		return false, 0
+	}
+	if turn < c.state.Rules.TurnLimit && !c.moveLogic.HasPlayerWon(board, player) && !c.moveLogic.HasPlayerWon(board, opponent) {
+		return false, 0
+	}
+	return true, c.finalHeuristic(board, ply, player, opponent)
+}
+
+// finalHeuristic rates a finished game: a single connected swarm wins,
+// otherwise the larger swarm wins.
+func (c *Controller) finalHeuristic(board *Board, ply int, player *Player, opponent *Player) float64 {
+	won := c.moveLogic.HasPlayerWon(board, player)
+	lost := c.moveLogic.HasPlayerWon(board, opponent)
+	if won == lost {
+		own := c.moveLogic.CalculateSwarmSize(board, player)
+		foreign := c.moveLogic.CalculateSwarmSize(board, opponent)
+		won = own > foreign
+		lost = foreign > own
+	}
+	switch {
+	case won:
+		return winScore - float64(ply)
+	case lost:
+		return -winScore + float64(ply)
+	}
+	return 0
+}
+
+// evaluateBoard rates board from the view of player by the swarms of both
+// players. It only depends on the position, so it fits the transposition
+// table whatever move led to the board.
+func (c *Controller) evaluateBoard(board *Board, player *Player, opponent *Player) float64 {
+	return c.rateSwarms(board, player) - c.rateSwarms(board, opponent)
+}
+
+// rateSwarms rates the piranhas of player: the larger swarm wins at the turn
+// limit, and piranhas spread far from each other are far from connecting.
+func (c *Controller) rateSwarms(board *Board, player *Player) float64 {
+	count := c.moveLogic.GetPiranhaCount(board, player)
+	if count == 0 {
+		return 0
+	}
+	spread := c.moveLogic.CalculateSwarmDistance(board, player) / float64(count)
+	return 2*float64(c.moveLogic.CalculateSwarmSize(board, player)) - c.moveLogic.CalculateDistanceToSwarm(board, player) - spread
+}
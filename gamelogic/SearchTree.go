@@ -0,0 +1,209 @@
+package gamelogic
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// TreeNode is a position explored by the search. Move leads to it, Score
+// rates Move from the view of the player making it, searched with the window
+// Alpha, Beta of that player and Depth remaining plies. Bound tells whether
+// Score is exact or only a bound. Notes explain why the search ended early
+// or skipped the node, e.g. a transposition table cutoff or futility pruning.
+type TreeNode struct {
+	Move     string      `json:"move,omitempty"`
+	Ply      int         `json:"ply"`
+	Depth    int         `json:"depth"`
+	Alpha    float64     `json:"alpha"`
+	Beta     float64     `json:"beta"`
+	Score    float64     `json:"score"`
+	Bound    string      `json:"bound,omitempty"`
+	Notes    []string    `json:"notes,omitempty"`
+	Children []*TreeNode `json:"children,omitempty"`
+}
+
+func (n *TreeNode) note(note string) {
+	if n != nil {
+		n.Notes = append(n.Notes, note)
+	}
+}
+
+// searchTrace records the tree of the current search iteration up to maxPly.
+// All methods do nothing on a nil trace, so the search calls them
+// unconditionally.
+type searchTrace struct {
+	maxPly int
+	root   *TreeNode
+	last   *TreeNode
+	stack  []*TreeNode
+}
+
+// SetSearchTrace makes the search record the explored tree up to maxPly
+// plies, 0 disables recording. Recording slows the search down, it is meant
+// for debugging.
+func (c *Controller) SetSearchTrace(maxPly int) {
+	c.stopPondering()
+	c.trace = nil
+	if maxPly > 0 {
+		c.trace = &searchTrace{maxPly: maxPly}
+	}
+}
+
+// SearchTree returns the tree of the last completed iteration of the last
+// search, nil if the search was not recorded.
+func (c *Controller) SearchTree() *TreeNode {
+	c.stopPondering()
+	if c.trace == nil {
+		return nil
+	}
+	return c.trace.last
+}
+
+func (t *searchTrace) start(depth int, alpha float64, beta float64) {
+	if t == nil {
+		return
+	}
+	t.root = &TreeNode{Depth: depth, Alpha: alpha, Beta: beta}
+	t.stack = append(t.stack[:0], t.root)
+}
+
+func (t *searchTrace) finish(score float64) {
+	if t == nil {
+		return
+	}
+	t.root.Score = score
+	t.root.Bound = boundOf(score, t.root.Alpha, t.root.Beta).String()
+}
+
+// commit keeps the tree of a completed iteration.
+func (t *searchTrace) commit() {
+	if t != nil {
+		t.last = t.root
+	}
+}
+
+// reset drops the last tree when a new search starts.
+func (t *searchTrace) reset() {
+	if t != nil {
+		t.last = nil
+		t.root = nil
+	}
+}
+
+func (t *searchTrace) top(ply int) *TreeNode {
+	if t == nil || len(t.stack) == 0 {
+		return nil
+	}
+	if node := t.stack[len(t.stack)-1]; node.Ply == ply {
+		return node
+	}
+	return nil
+}
+
+// enter records the search of move at ply, it returns nil beyond maxPly.
+func (t *searchTrace) enter(ply int, move *Move, depth int, alpha float64, beta float64) *TreeNode {
+	parent := t.top(ply - 1)
+	if parent == nil || ply > t.maxPly {
+		return nil
+	}
+	node := &TreeNode{Move: move.String(), Ply: ply, Depth: depth, Alpha: alpha, Beta: beta}
+	parent.Children = append(parent.Children, node)
+	t.stack = append(t.stack, node)
+	return node
+}
+
+func (t *searchTrace) leave(node *TreeNode, score float64) {
+	if node == nil {
+		return
+	}
+	node.Score = score
+	node.Bound = boundOf(score, node.Alpha, node.Beta).String()
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+// skip records a move at ply which was not searched.
+func (t *searchTrace) skip(ply int, move *Move, depth int, note string) {
+	if node := t.enter(ply, move, depth, 0, 0); node != nil {
+		node.Bound = ""
+		node.note(note)
+		t.stack = t.stack[:len(t.stack)-1]
+	}
+}
+
+// note annotates the node searched at ply.
+func (t *searchTrace) note(ply int, note string) {
+	t.top(ply).note(note)
+}
+
+// research drops the children of the node at ply before it is searched
+// again.
+func (t *searchTrace) research(ply int, note string) {
+	if node := t.top(ply); node != nil {
+		node.Children = nil
+		node.note(note)
+	}
+}
+
+// WriteDOT writes the tree as a Graphviz graph. Nodes which were not
+// searched are dashed, moves causing a cutoff are red.
+func WriteDOT(w io.Writer, root *TreeNode) error {
+	buffered := bufio.NewWriter(w)
+	fmt.Fprintln(buffered, "digraph search {")
+	fmt.Fprintln(buffered, "\tnode [shape=box, fontname=monospace];")
+	id := 0
+	var write func(node *TreeNode) int
+	write = func(node *TreeNode) int {
+		nodeID := id
+		id++
+		name := node.Move
+		if node.Ply == 0 {
+			name = "root"
+		}
+		label := []string{name}
+		attrs := ""
+		if node.Bound == "" {
+			attrs = ", style=dashed, color=gray"
+		} else {
+			label = append(label,
+				fmt.Sprintf("%s (%s)", formatScore(node.Score), node.Bound),
+				fmt.Sprintf("[%s, %s] depth %d", formatScore(node.Alpha), formatScore(node.Beta), node.Depth))
+		}
+		for _, note := range node.Notes {
+			if note == "cutoff" {
+				attrs += ", color=red"
+			}
+		}
+		if len(node.Notes) > 0 {
+			label = append(label, strings.Join(node.Notes, ", "))
+		}
+		fmt.Fprintf(buffered, "\tn%d [label=%q%s];\n", nodeID, strings.Join(label, "\n"), attrs)
+		for _, child := range node.Children {
+			childID := write(child)
+			fmt.Fprintf(buffered, "\tn%d -> n%d;\n", nodeID, childID)
+		}
+		return nodeID
+	}
+	if root != nil {
+		write(root)
+	}
+	fmt.Fprintln(buffered, "}")
+	return buffered.Flush()
+}
+
+// WriteTreeJSON writes the tree as nested JSON objects.
+func WriteTreeJSON(w io.Writer, root *TreeNode) error {
+	return json.NewEncoder(w).Encode(root)
+}
+
+func formatScore(score float64) string {
+	switch {
+	case score >= infinity:
+		return "inf"
+	case score <= -infinity:
+		return "-inf"
+	}
+	return fmt.Sprintf("%.2f", score)
+}
@@ -0,0 +1,98 @@
+package gamelogic
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// tacticalTimeFactor extends the time when captures or moves connecting
+	// a swarm are available, finalTurnsTimeFactor during the last
+	// finalTurns turns before the turn limit.
+	tacticalTimeFactor   = 1.5
+	finalTurnsTimeFactor = 1.5
+	finalTurns           = 10
+	// unstableTimeFactor extends the time whenever the best move changed in
+	// an iteration.
+	unstableTimeFactor = 1.4
+	// connectingMoves is the distance to a connected swarm from which on
+	// the position counts as tactical.
+	connectingMoves = 2
+)
+
+// TimeManager decides how long a move is searched. MoveTime is the time for
+// an ordinary move, it is extended in critical positions and shortened when
+// there is nothing to decide. MaxTime is the hard limit which is never
+// exceeded, it should be the timeout of the server minus a safety margin.
+type TimeManager struct {
+	MoveTime time.Duration
+	MaxTime  time.Duration
+}
+
+// SetTimeManager makes Evaluate divide its time with t, without a time
+// manager every search runs until its context is done.
+func (c *Controller) SetTimeManager(t *TimeManager) {
+	c.timeManager = t
+}
+
+// moveClock tracks the time of one move. An iteration of the search is only
+// started while less than half of the budget is used, as it usually takes
+// longer than all previous iterations together, and it is aborted once the
+// budget is used up.
+type moveClock struct {
+	start  time.Time
+	budget time.Duration
+	max    time.Duration
+}
+
+func (t *TimeManager) newClock(c *Controller, moves int) *moveClock {
+	clock := &moveClock{start: time.Now(), max: t.MaxTime}
+	if moves <= 1 {
+		// only the first iteration to rate the forced move
+		return clock
+	}
+	budget := float64(t.MoveTime)
+	if c.isTactical() {
+		budget *= tacticalTimeFactor
+	}
+	if c.state.Rules.TurnLimit-c.state.Turn <= finalTurns {
+		budget *= finalTurnsTimeFactor
+	}
+	clock.budget = clock.limit(time.Duration(budget))
+	return clock
+}
+
+func (m *moveClock) limit(d time.Duration) time.Duration {
+	if d > m.max {
+		return m.max
+	}
+	return d
+}
+
+// isTactical tells whether the own player can capture or complete the swarm
+// or either player is close to connecting.
+func (c *Controller) isTactical() bool {
+	board := c.state.board
+	if len(c.tacticalMoves(board, c.ownPlayer, c.foreignPlayer)) > 0 {
+		return true
+	}
+	return c.moveLogic.MovesToConnect(board, c.ownPlayer) <= connectingMoves ||
+		c.moveLogic.MovesToConnect(board, c.foreignPlayer) <= connectingMoves
+}
+
+// unstable extends the budget after the best move changed.
+func (m *moveClock) unstable() {
+	m.budget = m.limit(time.Duration(float64(m.budget) * unstableTimeFactor))
+}
+
+func (m *moveClock) startIteration() bool {
+	return time.Since(m.start) < m.budget/2
+}
+
+func (m *moveClock) iterationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithDeadline(ctx, m.start.Add(m.budget))
+}
+
+func (m *moveClock) hardContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithDeadline(ctx, m.start.Add(m.max))
+}
@@ -0,0 +1,31 @@
+package gamelogic
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// TestMaxTime checks that the hard limit also holds for the first iteration,
+// a search without time left plays the first legal move.
+func TestMaxTime(t *testing.T) {
+	state := NewGameState(NewStartBoard(rand.New(rand.NewSource(1)), DefaultRules()))
+	state.StartColor = ColorRed
+	state.CurrentColor = ColorRed
+	c := NewController(1 << 20)
+	c.SetPlayer(ColorRed)
+	c.UpdateState(state)
+	c.SetTimeManager(&TimeManager{MoveTime: time.Second, MaxTime: time.Nanosecond})
+
+	move, _, err := c.Evaluate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth := c.Stats().Depth; depth != 0 {
+		t.Errorf("search completed depth %d after the hard limit", depth)
+	}
+	if err := c.ValidateMove(move); err != nil {
+		t.Errorf("fallback move: %v", err)
+	}
+}
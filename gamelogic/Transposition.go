@@ -0,0 +1,157 @@
+package gamelogic
+
+import (
+	"math/rand"
+	"unsafe"
+)
+
+// zobristKeys holds one random key per field and field type, the hash of a
+// board is the xor of the keys of all its fields. Boards up to 16x16 fields
+// are supported.
+var zobristKeys = newZobristKeys(16, 16)
+
+func newZobristKeys(width int, height int) [][][4]uint64 {
+	r := rand.New(rand.NewSource(2019))
+	keys := make([][][4]uint64, height)
+	for y := range keys {
+		keys[y] = make([][4]uint64, width)
+		for x := range keys[y] {
+			for t := range keys[y][x] {
+				keys[y][x][t] = r.Uint64()
+			}
+		}
+	}
+	return keys
+}
+
+func (b *Board) Hash() uint64 {
+	if !b.hashed {
+		var hash uint64
+		for y := 0; y < b.height; y++ {
+			for x := 0; x < b.width; x++ {
+				hash ^= zobristKeys[y][x][b.GetField(x, y).T]
+			}
+		}
+		b.hash = hash
+		b.hashed = true
+	}
+	return b.hash
+}
+
+// positionHash distinguishes the same board with different players to move,
+// as search results are calculated from the view of the player to move, and
+// in different turns, as the game is only decided at the end of a round and
+// ends at the turn limit.
+func positionHash(board *Board, player *Player, turn int) uint64 {
+	hash := board.Hash() ^ uint64(turn)*0x9e3779b97f4a7c15
+	if player.color == ColorBlue {
+		return ^hash
+	}
+	return hash
+}
+
+// Bound tells whether a stored heuristic is exact or only a bound, as
+// alpha-beta cutoffs stop searching once a move is known to be good or bad
+// enough.
+type Bound int
+
+const (
+	BoundExact Bound = 0
+	BoundLower Bound = 1
+	BoundUpper Bound = 2
+)
+
+func (b Bound) String() string {
+	switch b {
+	case BoundLower:
+		return "lower"
+	case BoundUpper:
+		return "upper"
+	}
+	return "exact"
+}
+
+type transpositionEntry struct {
+	key       uint64
+	depth     int
+	heuristic float64
+	bound     Bound
+	move      *Move
+}
+
+// TranspositionTable caches search results by board hash. It never grows
+// beyond the memory bound given on creation, colliding entries are replaced
+// when the new result was searched at least as deep.
+type TranspositionTable struct {
+	entries []transpositionEntry
+	mask    uint64
+}
+
+const transpositionEntrySize = int(unsafe.Sizeof(transpositionEntry{}))
+
+func NewTranspositionTable(memory int) *TranspositionTable {
+	size := 1
+	for size*2*transpositionEntrySize <= memory {
+		size *= 2
+	}
+	return &TranspositionTable{entries: make([]transpositionEntry, size), mask: uint64(size - 1)}
+}
+
+// Lookup returns the stored result for the board searched at ply with at
+// least the given depth.
+func (t *TranspositionTable) Lookup(hash uint64, depth int, ply int) (float64, Bound, *Move, bool) {
+	entry := &t.entries[hash&t.mask]
+	if entry.key != hash || entry.depth < depth {
+		return 0, BoundExact, nil, false
+	}
+	return fromStoredHeuristic(entry.heuristic, ply), entry.bound, entry.move, true
+}
+
+// BestMove returns the stored best move for the board regardless of the
+// depth it was searched with.
+func (t *TranspositionTable) BestMove(hash uint64) *Move {
+	entry := &t.entries[hash&t.mask]
+	if entry.key != hash {
+		return nil
+	}
+	return entry.move
+}
+
+// Store keeps the result for the board searched at ply.
+func (t *TranspositionTable) Store(hash uint64, depth int, ply int, heuristic float64, bound Bound, move *Move) {
+	entry := &t.entries[hash&t.mask]
+	if entry.key == hash && entry.depth > depth {
+		return
+	}
+	*entry = transpositionEntry{key: hash, depth: depth, heuristic: toStoredHeuristic(heuristic, ply), bound: bound, move: move}
+}
+
+// toStoredHeuristic makes the score of a finished game, which counts the
+// plies from the root, count them from the stored board instead, so it stays
+// valid when the board is reached at another ply. fromStoredHeuristic
+// reverses it.
+func toStoredHeuristic(heuristic float64, ply int) float64 {
+	switch {
+	case heuristic > winScore-float64(maxPly):
+		return heuristic + float64(ply)
+	case heuristic < -winScore+float64(maxPly):
+		return heuristic - float64(ply)
+	}
+	return heuristic
+}
+
+func fromStoredHeuristic(heuristic float64, ply int) float64 {
+	switch {
+	case heuristic > winScore-float64(maxPly):
+		return heuristic - float64(ply)
+	case heuristic < -winScore+float64(maxPly):
+		return heuristic + float64(ply)
+	}
+	return heuristic
+}
+
+func (t *TranspositionTable) Clear() {
+	for i := range t.entries {
+		t.entries[i] = transpositionEntry{}
+	}
+}
@@ -0,0 +1,26 @@
+package gamelogic
+
+import "testing"
+
+func TestTranspositionWinScores(t *testing.T) {
+	tests := []struct {
+		name      string
+		heuristic float64
+		storePly  int
+		lookupPly int
+		expected  float64
+	}{
+		// a win two plies after the board, found at ply 3
+		{name: "win", heuristic: winScore - 5, storePly: 3, lookupPly: 1, expected: winScore - 3},
+		{name: "loss", heuristic: -winScore + 5, storePly: 3, lookupPly: 7, expected: -winScore + 9},
+		{name: "unfinished", heuristic: 12.5, storePly: 3, lookupPly: 1, expected: 12.5},
+	}
+	for _, test := range tests {
+		tt := NewTranspositionTable(1 << 10)
+		tt.Store(42, 2, test.storePly, test.heuristic, BoundExact, nil)
+		heuristic, _, _, ok := tt.Lookup(42, 2, test.lookupPly)
+		if !ok || heuristic != test.expected {
+			t.Errorf("%s: looked up %v, expected %v", test.name, heuristic, test.expected)
+		}
+	}
+}
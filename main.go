@@ -2,210 +2,581 @@ package main
 
 import (
 	"PWBSS2019/gamelogic"
-	"encoding/xml"
+	"PWBSS2019/protocol"
+	"PWBSS2019/replay"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/pborman/getopt"
 	"io"
+	"math/rand"
 	"net"
 	"os"
+	"os/signal"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
 )
 
-type Room struct {
-	Id string `xml:"roomId"`
+// Client plays one game at a time with its own controller.
+type Client struct {
+	Controller *gamelogic.Controller
+	MoveTime   time.Duration
+	ReplayDir  string
+	ReplayGzip bool
+	Debug      bool
+	Paranoid   bool
+	Ponder     bool
+	Reports    *reportLog
+	TreeDir    string
+	Adjacency  gamelogic.Adjacency
+	Outcome    string
+	color      gamelogic.Color
+	replay     *replay.Writer
 }
 
-type Joined struct {
-	Id string `xml:"roomId"`
-}
+const (
+	OutcomeWon  = "won"
+	OutcomeLost = "lost"
+	OutcomeDraw = "draw"
+)
 
-type WelcomeMessage struct {
-	Color string `xml:"color,attr"`
+// Connection describes how a client connects to the server and joins a game.
+type Connection struct {
+	Address      string
+	Reservation  string
+	Room         string
+	Retries      int
+	RetryDelay   time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	RecordDir    string
 }
 
-type MementoMessage struct {
-	State StateMessage `xml:"state"`
-}
+// Process reads the server messages from r and answers move requests on w.
+// It returns nil once the server closed the protocol and an error describing
+// what went wrong otherwise. Every move search is cancelled after MoveTime,
+// unless it is 0, or when ctx is done.
+func (c *Client) Process(ctx context.Context, r io.Reader, w io.Writer) error {
+	defer c.closeReplay()
+	defer c.Controller.StopPondering()
+	d := protocol.NewDecoder(r)
+	if c.Debug {
+		d.Debugf = func(format string, v ...interface{}) {
+			fmt.Fprintf(os.Stderr, "debug: "+format+"\n", v...)
+		}
+	}
+	for {
+		msg, err := d.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if decodeErr, ok := err.(*protocol.DecodeError); ok && !decodeErr.Fatal {
+				fmt.Fprintf(os.Stderr, "skipping malformed server message: %v\n", err)
+				continue
+			}
+			return fmt.Errorf("could not read server message: %v", err)
+		}
 
-type PlayerMessage struct {
-	DisplayName string `xml:"displayName,attr"`
-	Color       string `xml:"color,attr"`
+		switch msg.Name {
+		case "data":
+			switch msg.Class {
+			case protocol.ClassMemento:
+				state, err := protocol.NewGameState(&msg.Memento.State)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "skipping invalid memento: %v\n", err)
+					continue
+				}
+				// the protocol does not transmit the rules
+				state.Rules.Adjacency = c.Adjacency
+				if err := c.Controller.UpdateState(state); err != nil {
+					fmt.Fprintf(os.Stderr, "illegal move in turn %d: %v\n", state.Turn, err)
+				}
+				c.writeReplay(func(rw *replay.Writer) error { return rw.WriteMemento(msg.Memento.State) })
+			case protocol.ClassWelcome:
+				c.color = protocol.StringToColor(msg.Welcome.Color)
+				c.Controller.SetPlayer(c.color)
+			case protocol.ClassMoveRequest:
+				move, pv, err := nextMove(ctx, c.Controller, c.MoveTime, c.Paranoid)
+				roomID := c.Controller.RoomID()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "could not calculate any move: %v\n", err)
+					continue
+				}
+				hint := ""
+				if len(pv) > 0 {
+					hint = fmt.Sprintf("<hint content=\"pv %s\" />", xmlEscape(gamelogic.FormatMoves(pv)))
+				}
+				_, err = io.WriteString(w, fmt.Sprintf("<room roomId=\"%s\"><data class=\"move\" x=\"%d\" y=\"%d\" direction=\"%s\">%s</data></room>", roomID, move.X, move.Y, move.Direction.String(), hint))
+				if err != nil {
+					return fmt.Errorf("could not send move: %v", err)
+				}
+				c.writeReplay(func(rw *replay.Writer) error { return rw.WriteMove(move.X, move.Y, move.Direction.String()) })
+				// only moves of the search come with a principal variation
+				if c.Reports != nil && pv != nil {
+					if err := c.Reports.write(c.Controller.Report()); err != nil {
+						fmt.Fprintf(os.Stderr, "could not write move report: %v\n", err)
+					}
+				}
+				if c.TreeDir != "" && pv != nil {
+					if err := writeSearchTree(c.TreeDir, c.Controller); err != nil {
+						fmt.Fprintf(os.Stderr, "could not write search tree: %v\n", err)
+					}
+				}
+				if c.Ponder {
+					c.Controller.Ponder(move)
+				}
+			case protocol.ClassResult:
+				result := msg.Result
+				c.Controller.StopPondering()
+				c.writeReplay(func(rw *replay.Writer) error { return rw.WriteResult(result) })
+				if result.Winner != nil {
+					fmt.Printf("game over, winner: %s (%s)\n", result.Winner.DisplayName, result.Winner.Color)
+					c.Outcome = OutcomeLost
+					if protocol.StringToColor(result.Winner.Color) == c.color {
+						c.Outcome = OutcomeWon
+					}
+				} else {
+					fmt.Println("game over, draw")
+					c.Outcome = OutcomeDraw
+				}
+			}
+		case "error":
+			return fmt.Errorf("server error: %s", msg.Attrs["message"])
+		case "joined":
+			fmt.Printf("joined room %s\n", msg.RoomID)
+			c.Controller.JoinRoom(msg.RoomID)
+			c.createReplay(msg.RoomID)
+		}
+	}
 }
 
-type StateMessage struct {
-	RedPlayer  PlayerMessage `xml:"red"`
-	BluePlayer PlayerMessage `xml:"blue"`
-	Board      BoardMessage  `xml:"board"`
-	StartPlayerColor string `xml:"startPlayerColor,attr"`
-	CurrentPlayerColor string `xml:"currentPlayerColor,attr"`
-	Turn int `xml:"turn,attr"`
-	LastMove *MoveMessage `xml:"lastMove"`
+func (c *Client) createReplay(roomID string) {
+	if c.ReplayDir == "" {
+		return
+	}
+	c.closeReplay()
+	name := fmt.Sprintf("%s_%s", time.Now().Format("20060102-150405"), roomID)
+	w, err := replay.Create(c.ReplayDir, name, roomID, c.ReplayGzip)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not create replay: %v\n", err)
+		return
+	}
+	c.replay = w
 }
 
-type MoveMessage struct {
-	X int `xml:"x,attr"`
-	Y int `xml:"y,attr"`
-	Direction string `xml:"direction,attr"`
+func (c *Client) writeReplay(write func(*replay.Writer) error) {
+	if c.replay == nil {
+		return
+	}
+	if err := write(c.replay); err != nil {
+		fmt.Fprintf(os.Stderr, "could not write replay: %v\n", err)
+	}
 }
 
-type FieldMessage struct {
-	FieldState string `xml:"state,attr"`
-	X int `xml:"x,attr"`
-	Y int `xml:"y,attr"`
+func (c *Client) closeReplay() {
+	if c.replay == nil {
+		return
+	}
+	if err := c.replay.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "could not write replay: %v\n", err)
+	}
+	c.replay = nil
 }
 
-type FieldsMessage struct {
-	Fields []FieldMessage `xml:"field"`
+type moveStrategy struct {
+	name string
+	move func() (*gamelogic.Move, error)
 }
 
-type BoardMessage struct {
-	Fields []FieldsMessage `xml:"fields"`
-}
+// nextMove tries the move strategies from best to cheapest until one yields a
+// move. In paranoid mode a move failing the legality check counts as a failed
+// strategy, so an illegal move is never sent.
+func nextMove(ctx context.Context, controller *gamelogic.Controller, moveTime time.Duration, paranoid bool) (*gamelogic.Move, []*gamelogic.Move, error) {
+	var pv []*gamelogic.Move
+	strategies := []moveStrategy{
+		{"search", func() (*gamelogic.Move, error) {
+			moveCtx := ctx
+			if moveTime > 0 {
+				var cancel context.CancelFunc
+				moveCtx, cancel = context.WithTimeout(ctx, moveTime)
+				defer cancel()
+			}
+			move, variation, err := controller.NextTurn(moveCtx)
+			pv = variation
+			return move, err
+		}},
+		{"quick search", controller.QuickMove},
+		{"any legal move", controller.AnyMove},
+	}
 
-func StringToFieldType(s string) gamelogic.FieldType {
-	switch s {
-	case "EMPTY":
-		return gamelogic.FieldTypeEmpty
-	case "RED":
-		return gamelogic.FieldTypeRed
-	case "BLUE":
-		return gamelogic.FieldTypeBlue
-	case "OBSTRUCTED":
-		return gamelogic.FieldTypeObstructed
+	var err error
+	for _, strategy := range strategies {
+		var move *gamelogic.Move
+		move, err = callStrategy(strategy)
+		if err == nil && move != nil && paranoid {
+			err = controller.ValidateMove(move)
+		}
+		if err == nil && move != nil {
+			return move, pv, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("no move returned")
+		}
+		// the principal variation only belongs to a move of the search
+		pv = nil
+		logMoveFailure(controller, strategy.name, err)
 	}
-	return gamelogic.FieldTypeEmpty
+	return nil, nil, err
 }
 
-func StringToColor(s string) gamelogic.Color {
-	switch s {
-	case "blue":
-		return gamelogic.ColorBlue
-	case "red":
-		return gamelogic.ColorRed
-	}
-	return gamelogic.ColorBlue
+func callStrategy(strategy moveStrategy) (move *gamelogic.Move, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return strategy.move()
 }
 
-func createGameState(state *StateMessage) *gamelogic.GameState {
-	fields := make([][]*gamelogic.Field, 10)
-	for i := 0; i < len(fields); i++ {
-		fields[i] = make([]*gamelogic.Field, 10)
+func logMoveFailure(controller *gamelogic.Controller, strategy string, err error) {
+	fmt.Fprintf(os.Stderr, "%s failed: %v\n", strategy, err)
+	if state := controller.State(); state != nil {
+		fmt.Fprintf(os.Stderr, "turn %d, position:\n%s", state.Turn, state.Board())
 	}
+}
 
-	for _, f := range state.Board.Fields {
+// deadlineReader fails a read when the server did not send anything for the
+// given timeout, so a stalled server does not block the client forever.
+type deadlineReader struct {
+	conn    net.Conn
+	timeout time.Duration
+}
 
-		for _, field := range f.Fields {
-			fields[field.Y][field.X] = &gamelogic.Field{X:field.X, Y:field.Y, T:StringToFieldType(field.FieldState)}
+func (r *deadlineReader) Read(p []byte) (int, error) {
+	if r.timeout > 0 {
+		if err := r.conn.SetReadDeadline(time.Now().Add(r.timeout)); err != nil {
+			return 0, err
 		}
 	}
+	return r.conn.Read(p)
+}
 
-	board := gamelogic.NewBoard(fields, 10, 10)
+// deadlineWriter fails a write which the server did not accept within the
+// given timeout.
+type deadlineWriter struct {
+	conn    net.Conn
+	timeout time.Duration
+}
 
-	return gamelogic.NewGameState(board)
+func (w *deadlineWriter) Write(p []byte) (int, error) {
+	if w.timeout > 0 {
+		if err := w.conn.SetWriteDeadline(time.Now().Add(w.timeout)); err != nil {
+			return 0, err
+		}
+	}
+	return w.conn.Write(p)
 }
 
-func Process(r io.Reader, w io.Writer) error {
-	d := xml.NewDecoder(r)
-	for {
-		v, err := d.Token()
-		if err != nil {
-			return err
+func dial(address string, retries int, delay time.Duration) (net.Conn, error) {
+	for attempt := 0; ; attempt++ {
+		con, err := net.Dial("tcp", address)
+		if err == nil || attempt >= retries {
+			return con, err
 		}
+		fmt.Fprintf(os.Stderr, "could not connect to server %s: %v, retrying in %v\n", address, err, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
 
-		switch t := v.(type) {
+// searchOptionFlags registers the pruning thresholds of the search on set.
+func searchOptionFlags(set *getopt.Set) *gamelogic.SearchOptions {
+	options := gamelogic.DefaultSearchOptions()
+	set.IntVarLong(&options.LMRMinDepth, "lmr-depth", 0, "minimum remaining depth for late move reductions")
+	set.IntVarLong(&options.LMRMinMoves, "lmr-moves", 0, "number of moves searched fully before reducing")
+	set.IntVarLong(&options.LMRReduction, "lmr-reduction", 0, "plies late moves are reduced by, 0 disables reductions")
+	set.IntVarLong(&options.FutilityDepth, "futility-depth", 0, "maximum remaining depth for futility pruning, 0 disables it")
+	set.VarLong((*float64Value)(&options.FutilityMargin), "futility-margin", 0, "heuristic margin per remaining ply for futility pruning")
+	set.IntVarLong(&options.EndgamePiranhas, "endgame-piranhas", 0, "solve the endgame exactly once both players have at most this many piranhas, 0 disables it")
+	set.IntVarLong(&options.EndgameMovesToConnect, "endgame-connect", 0, "solve the endgame exactly once a player is this many moves from connecting, 0 disables it")
+	return &options
+}
 
-		case xml.StartElement:
-			switch t.Name.Local {
-			case "data":
-				var class string = ""
-				for _, v := range t.Attr {
-					if v.Name.Local == "class" {
-						class = v.Value
-						break
-					}
-				}
-				switch class {
-				case "memento":
-					data := new(MementoMessage)
-					err := d.DecodeElement(data, &t)
-					if err != nil {
-						return err
-					}
-					gamelogic.GetController().UpdateState(createGameState(&data.State))
+type float64Value float64
 
-				case "welcomeMessage":
-					data := new(WelcomeMessage)
-					err := d.DecodeElement(data, &t)
-					if err != nil {
-						return err
-					}
-					gamelogic.GetController().SetPlayer(StringToColor(data.Color))
-				case "sc.framework.plugins.protocol.MoveRequest":
-					move, err := gamelogic.GetController().NextTurn()
-					roomID := gamelogic.GetController().RoomID()
-					if err != nil {
-						panic(err)
-					}
-					io.WriteString(w, fmt.Sprintf("<room roomId=\"%s\"><data class=\"move\" x=\"%d\" y=\"%d\" direction=\"%s\" /></room>", roomID, move.X, move.Y, move.Direction.String()))
-				default:
-					fmt.Printf("got data of class %s\n", class)
+func (f *float64Value) Set(value string, opt getopt.Option) error {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("%s: invalid number %q", opt.Name(), value)
+	}
+	*f = float64Value(v)
+	return nil
+}
 
-				}
-			case "joined":
-				for _, v := range t.Attr {
-					if v.Name.Local == "roomId" {
-						gamelogic.GetController().JoinRoom(v.Value)
-						break
-					}
-				}
+func (f *float64Value) String() string {
+	return strconv.FormatFloat(float64(*f), 'g', -1, 64)
+}
 
-			default:
-				//fmt.Printf("got xml start tag %s\n", t.Name.Local)
-			}
+// errUsage is returned after the usage of a command has been printed.
+var errUsage = errors.New("invalid arguments")
 
-		case xml.EndElement:
-			//fmt.Printf("got xml end tag %s\n", t.Name.Local)
+func main() {
+	fmt.Println(os.Args)
+	if err := run(); err != nil {
+		if err != errUsage {
+			fmt.Fprintln(os.Stderr, err)
 		}
+		os.Exit(1)
 	}
 }
 
-func main() {
-	fmt.Println(os.Args)
+// run executes the command given on the command line, all deferred cleanup
+// is done by the time it returns.
+func run() error {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "server":
+			return serverMain(os.Args[1:])
+		case "replay":
+			return replayMain(os.Args[1:])
+		case "observe":
+			return observeMain(os.Args[1:])
+		case "admin":
+			return adminMain(os.Args[1:])
+		case "bench":
+			return benchMain(os.Args[1:])
+		case "arena":
+			return arenaMain(os.Args[1:])
+		case "book":
+			return bookMain(os.Args[1:])
+		}
+	}
+
 	testmode := getopt.BoolLong("test", 't', "")
 	host := getopt.StringLong("host", 'h', "localhost", "")
 	port := getopt.IntLong("port", 'p', 13050, "")
 	reservation := getopt.StringLong("reservation", 'r', "", "")
+	room := getopt.StringLong("room", 0, "", "id of an existing room to join")
+	retries := getopt.IntLong("retries", 0, 5, "number of connection retries")
+	retryDelay := getopt.DurationLong("retry-delay", 0, 500*time.Millisecond, "delay before the first retry, doubled for every further retry")
+	readTimeout := getopt.DurationLong("read-timeout", 0, time.Minute, "maximum time to wait for a server message")
+	writeTimeout := getopt.DurationLong("write-timeout", 0, 10*time.Second, "maximum time to wait for the server to accept a message")
+	moveTime := getopt.DurationLong("move-time", 0, time.Second, "time for an ordinary move, critical positions get more up to the time limit minus the safety margin")
+	timeLimit := getopt.DurationLong("time-limit", 0, 2*time.Second, "time the server allows for a move")
+	safetyMargin := getopt.DurationLong("safety-margin", 0, 200*time.Millisecond, "time kept back from the time limit for sending the move")
+	replayDir := getopt.StringLong("replay-dir", 0, "", "directory to record a replay of every game into")
+	replayGzip := getopt.BoolLong("replay-gzip", 0, "compress recorded replays with gzip")
+	recordDir := getopt.StringLong("record", 0, "", "directory to record the raw server traffic into, the moves can only be verified by --playback when searched with --depth")
+	playbackPrefix := getopt.StringLong("playback", 0, "", "replay recorded traffic <dir>/<timestamp>-<pid>-<n> and check the sent moves, requires the --depth of the recording")
+	depth := getopt.IntLong("depth", 0, 0, "maximum search depth, 0 searches until the move time is up")
+	games := getopt.IntLong("games", 0, 1, "number of games to play in parallel")
+	debug := getopt.BoolLong("debug", 0, "log ignored protocol messages")
+	paranoid := getopt.BoolLong("paranoid", 0, "check every move for legality before sending it")
+	ponder := getopt.BoolLong("ponder", 0, "keep searching the expected reply of the opponent while waiting for the next move request")
+	adjacency := getopt.StringLong("adjacency", 0, gamelogic.AdjacencyDiagonal.String(), "which piranhas form a swarm in the played variant: diagonal or orthogonal")
+	ttMemory := getopt.IntLong("tt-memory", 0, gamelogic.DefaultTranspositionMemory>>20, "transposition table size per game in MB")
+	reportPath := getopt.StringLong("report", 0, "", "file to append a JSON report of every searched move to")
+	treeDir := getopt.StringLong("search-tree", 0, "", "directory to write the search tree of every move into as Graphviz and JSON file")
+	treeDepth := getopt.IntLong("search-tree-depth", 0, 2, "number of plies of the search tree to write")
+	bookPath := getopt.StringLong("book", 0, "", "opening book to play the first moves from")
+	searchOptions := searchOptionFlags(getopt.CommandLine)
 	getopt.Parse()
 
+	swarmAdjacency, err := gamelogic.ParseAdjacency(*adjacency)
+	if err != nil {
+		return err
+	}
+	maxMoveTime := *timeLimit - *safetyMargin
+	if maxMoveTime <= 0 {
+		return fmt.Errorf("the safety margin must be less than the time limit")
+	}
+	var book *gamelogic.Book
+	if *bookPath != "" {
+		if book, err = loadBook(*bookPath); err != nil {
+			return err
+		}
+	}
+	var reports *reportLog
+	if *reportPath != "" {
+		if reports, err = openReportLog(*reportPath); err != nil {
+			return fmt.Errorf("could not open report file: %v", err)
+		}
+		defer reports.close()
+	}
+	if *replayDir != "" {
+		if err := os.MkdirAll(*replayDir, 0755); err != nil {
+			return fmt.Errorf("could not create replay directory: %v", err)
+		}
+	}
+	if *treeDir != "" {
+		if *treeDepth < 1 {
+			return fmt.Errorf("--search-tree-depth must be at least 1")
+		}
+		if err := os.MkdirAll(*treeDir, 0755); err != nil {
+			return fmt.Errorf("could not create search tree directory: %v", err)
+		}
+	}
+	newClient := func() *Client {
+		controller := gamelogic.NewController(*ttMemory << 20)
+		controller.SetSearchOptions(*searchOptions)
+		controller.SetMaxDepth(*depth)
+		if *treeDir != "" {
+			controller.SetSearchTrace(*treeDepth)
+		}
+		controller.SetTimeManager(&gamelogic.TimeManager{MoveTime: *moveTime, MaxTime: maxMoveTime})
+		if book != nil {
+			controller.SetBook(book, rand.New(rand.NewSource(time.Now().UnixNano())))
+		}
+		return &Client{
+			Controller: controller,
+			MoveTime:   maxMoveTime,
+			ReplayDir:  *replayDir,
+			ReplayGzip: *replayGzip,
+			Debug:      *debug,
+			Paranoid:   *paranoid,
+			Ponder:     *ponder,
+			Reports:    reports,
+			TreeDir:    *treeDir,
+			Adjacency:  swarmAdjacency,
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+
 	if *testmode {
-		file, _ :=os.Open("i.xml")
-		err := Process(file, os.Stderr)
+		file, err := os.Open("i.xml")
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("could not open test input: %v", err)
 		}
-		return
+		defer file.Close()
+		return newClient().Process(ctx, file, os.Stderr)
 	}
 
-	con, err := net.Dial("tcp", fmt.Sprintf("%s:%d", *host, *port))
+	if *playbackPrefix != "" {
+		if *depth < 1 {
+			return fmt.Errorf("--playback requires the --depth the recording was made with")
+		}
+		if *bookPath != "" || *ponder {
+			return fmt.Errorf("--playback cannot be combined with --book or --ponder")
+		}
+		if err := playback(ctx, newClient(), *playbackPrefix); err != nil {
+			return fmt.Errorf("playback failed: %v", err)
+		}
+		fmt.Println("playback matches the recording")
+		return nil
+	}
+
+	connection := &Connection{
+		Address:      net.JoinHostPort(*host, strconv.Itoa(*port)),
+		Reservation:  *reservation,
+		Room:         *room,
+		Retries:      *retries,
+		RetryDelay:   *retryDelay,
+		ReadTimeout:  *readTimeout,
+		WriteTimeout: *writeTimeout,
+		RecordDir:    *recordDir,
+	}
+
+	if *games > 1 {
+		if *reservation != "" || *room != "" {
+			return fmt.Errorf("--games cannot be combined with --reservation or --room")
+		}
+		playGames(ctx, *games, newClient, connection)
+		return nil
+	}
+
+	if err := newClient().Play(ctx, connection); err != nil {
+		return fmt.Errorf("game aborted: %v", err)
+	}
+	return nil
+}
+
+// Play connects to the server, joins a game and plays it until the end.
+func (c *Client) Play(ctx context.Context, connection *Connection) error {
+	con, err := dial(connection.Address, connection.Retries, connection.RetryDelay)
 	if err != nil {
-		panic(fmt.Sprintf("could not connect to server %s:%d", *host, *port))
+		return fmt.Errorf("could not connect to server %s: %v", connection.Address, err)
 	}
+	defer con.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			con.Close()
+		case <-done:
+		}
+	}()
 	fmt.Println("connected to server")
+
+	var in io.Reader = &deadlineReader{conn: con, timeout: connection.ReadTimeout}
+	var out io.Writer = &deadlineWriter{conn: con, timeout: connection.WriteTimeout}
+	if connection.RecordDir != "" {
+		var stop func()
+		in, out, stop, err = record(connection.RecordDir, in, out)
+		if err != nil {
+			return fmt.Errorf("could not record traffic: %v", err)
+		}
+		defer stop()
+	}
+
 	//	d := xml.NewDecoder(con)
-	_, err = io.WriteString(con, "<protocol>")
+	_, err = io.WriteString(out, "<protocol>")
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("could not send protocol start: %v", err)
 	}
-	if *reservation == "" {
-		_, err =io.WriteString(con, "<join gameType=\"swc_2019_piranhas\"/>")
-		if err != nil {
-			panic(err)
-		}
+	if connection.Reservation != "" {
+		_, err =io.WriteString(out, fmt.Sprintf("<joinPrepared reservationCode=\"%s\"/>", xmlEscape(connection.Reservation)))
+	} else if connection.Room != "" {
+		_, err = io.WriteString(out, fmt.Sprintf("<joinRoom roomId=\"%s\"/>", xmlEscape(connection.Room)))
 	} else {
-		_, err =io.WriteString(con, fmt.Sprintf("<joinPrepared reservationCode=\"%s\"/>", *reservation))
-		if err != nil {
-			panic(err)
+		_, err =io.WriteString(out, "<join gameType=\""+protocol.GameType+"\"/>")
+	}
+	if err != nil {
+		return fmt.Errorf("could not join game: %v", err)
+	}
+	return c.Process(ctx, in, out)
+}
+
+// playGames plays the given number of games in parallel, each with its own
+// client, and prints a summary of the outcomes.
+func playGames(ctx context.Context, games int, newClient func() *Client, connection *Connection) {
+	clients := make([]*Client, games)
+	errs := make([]error, games)
+	var wg sync.WaitGroup
+	for i := range clients {
+		clients[i] = newClient()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = clients[i].Play(ctx, connection)
+		}(i)
+	}
+	wg.Wait()
+
+	counts := make(map[string]int)
+	for i, c := range clients {
+		if errs[i] != nil {
+			fmt.Fprintf(os.Stderr, "game %d aborted: %v\n", i+1, errs[i])
+			counts["aborted"]++
+			continue
+		}
+		if c.Outcome == "" {
+			fmt.Fprintf(os.Stderr, "game %d ended without a result\n", i+1)
+			counts["unfinished"]++
+			continue
 		}
+		counts[c.Outcome]++
 	}
-	err = Process(con, con)
-	fmt.Printf("Err: Mensch vs AI-Manual%#v\n", err)
-}
\ No newline at end of file
+	fmt.Printf("played %d games: %d won, %d lost, %d draw, %d aborted, %d unfinished\n", games, counts[OutcomeWon], counts[OutcomeLost], counts[OutcomeDraw], counts["aborted"], counts["unfinished"])
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"PWBSS2019/gamelogic"
+	"PWBSS2019/server"
+	"context"
+	"math/rand"
+	"net"
+	"testing"
+)
+
+// TestClientPlay plays a full game of two clients against the local server
+// over TCP. One of them ponders, so both ways of answering move requests
+// are used.
+func TestClientPlay(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s := server.NewServer()
+	s.Rand = rand.New(rand.NewSource(1))
+	connection := &Connection{Address: l.Addr().String()}
+	clients := make([]*Client, 2)
+	errs := make(chan error, len(clients))
+	for i := range clients {
+		controller := gamelogic.NewController(1 << 20)
+		controller.SetMaxDepth(1)
+		clients[i] = &Client{Controller: controller, Ponder: i == 1}
+	}
+
+	type served struct {
+		result *server.Result
+		err    error
+	}
+	done := make(chan served, 1)
+	go func() {
+		result, err := s.PlayGame(l)
+		done <- served{result, err}
+	}()
+	for _, c := range clients {
+		go func(c *Client) { errs <- c.Play(context.Background(), connection) }(c)
+	}
+	game := <-done
+	for range clients {
+		if err := <-errs; err != nil {
+			t.Errorf("client failed: %v", err)
+		}
+	}
+	if game.err != nil {
+		t.Fatal(game.err)
+	}
+	result := game.result
+	if result.Cause != server.CauseRegular {
+		t.Errorf("game ended with cause %s (%s), expected %s", result.Cause, result.Reason, server.CauseRegular)
+	}
+	if result.Turn == 0 {
+		t.Errorf("game ended without a move")
+	}
+
+	for i, c := range clients {
+		expected := OutcomeDraw
+		if !result.Draw {
+			expected = OutcomeLost
+			if result.Winner == c.color {
+				expected = OutcomeWon
+			}
+		}
+		if c.Outcome != expected {
+			t.Errorf("client %d playing %s saw outcome %q, expected %q", i, colorName(c.color), c.Outcome, expected)
+		}
+	}
+	if clients[0].color == clients[1].color {
+		t.Errorf("both clients play %s", colorName(clients[0].color))
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"PWBSS2019/gamelogic"
+	"PWBSS2019/protocol"
+	"encoding/xml"
+	"fmt"
+	"github.com/pborman/getopt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func observeMain(args []string) error {
+	set := getopt.New()
+	host := set.StringLong("host", 'h', "localhost", "server host")
+	port := set.IntLong("port", 'p', 13050, "server port")
+	password := set.StringLong("password", 'a', "", "administrator password of the server")
+	moveTime := set.DurationLong("move-time", 0, 500*time.Millisecond, "time budget for evaluating a position")
+	set.SetParameters("room-id")
+	set.Parse(args)
+	if set.NArgs() != 1 {
+		set.PrintUsage(os.Stderr)
+		return errUsage
+	}
+
+	address := net.JoinHostPort(*host, strconv.Itoa(*port))
+	con, err := net.Dial("tcp", address)
+	if err != nil {
+		return fmt.Errorf("could not connect to server %s: %v", address, err)
+	}
+	defer con.Close()
+
+	_, err = fmt.Fprintf(con, "<protocol><authenticate passphrase=\"%s\"/><observe roomId=\"%s\"/>", xmlEscape(*password), xmlEscape(set.Arg(0)))
+	if err != nil {
+		return fmt.Errorf("could not send observe request: %v", err)
+	}
+	return observe(con, os.Stdout, *moveTime)
+}
+
+// observe renders every memento received from r and prints the engine's
+// evaluation of the position until the game is over.
+func observe(r io.Reader, w io.Writer, moveTime time.Duration) error {
+	controller := gamelogic.NewController(gamelogic.DefaultTranspositionMemory)
+	d := protocol.NewDecoder(r)
+	for {
+		msg, err := d.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if decodeErr, ok := err.(*protocol.DecodeError); ok && !decodeErr.Fatal {
+				fmt.Fprintf(os.Stderr, "skipping malformed server message: %v\n", err)
+				continue
+			}
+			return fmt.Errorf("could not read server message: %v", err)
+		}
+
+		switch msg.Name {
+		case "observed":
+			fmt.Fprintf(w, "observing room %s\n", msg.RoomID)
+		case "error":
+			return fmt.Errorf("server error: %s", msg.Attrs["message"])
+		case "left":
+			return nil
+		case "data":
+			switch msg.Class {
+			case protocol.ClassMemento:
+				data := msg.Memento
+				state, err := protocol.NewGameState(&data.State)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "skipping invalid memento: %v\n", err)
+					continue
+				}
+				// clear the terminal so the board is redrawn in place
+				fmt.Fprint(w, "\033[H\033[2J")
+				fmt.Fprintf(w, "%s (red) vs. %s (blue)\n", data.State.RedPlayer.DisplayName, data.State.BluePlayer.DisplayName)
+				printPosition(w, state)
+				move, heuristic, err := evaluatePosition(controller, state, moveTime)
+				if err != nil {
+					fmt.Fprintf(w, "evaluation: %v\n", err)
+				} else {
+					fmt.Fprintf(w, "evaluation for %s: %.2f, best move %s\n", colorName(state.CurrentColor), heuristic, move.String())
+					printEndgame(w, controller, state)
+				}
+			case protocol.ClassResult:
+				data := msg.Result
+				if data.Winner != nil {
+					fmt.Fprintf(w, "game over, winner: %s (%s)\n", data.Winner.DisplayName, data.Winner.Color)
+				} else {
+					fmt.Fprintln(w, "game over, draw")
+				}
+			}
+		}
+	}
+}
+
+func attrValue(t xml.StartElement, name string) string {
+	for _, a := range t.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
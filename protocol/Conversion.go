@@ -0,0 +1,128 @@
+package protocol
+
+import (
+	"PWBSS2019/gamelogic"
+	"fmt"
+	"strings"
+)
+
+func StringToFieldType(s string) gamelogic.FieldType {
+	switch s {
+	case "EMPTY":
+		return gamelogic.FieldTypeEmpty
+	case "RED":
+		return gamelogic.FieldTypeRed
+	case "BLUE":
+		return gamelogic.FieldTypeBlue
+	case "OBSTRUCTED":
+		return gamelogic.FieldTypeObstructed
+	}
+	return gamelogic.FieldTypeEmpty
+}
+
+func FieldTypeToString(t gamelogic.FieldType) string {
+	switch t {
+	case gamelogic.FieldTypeRed:
+		return "RED"
+	case gamelogic.FieldTypeBlue:
+		return "BLUE"
+	case gamelogic.FieldTypeObstructed:
+		return "OBSTRUCTED"
+	}
+	return "EMPTY"
+}
+
+func StringToColor(s string) gamelogic.Color {
+	switch strings.ToLower(s) {
+	case "blue":
+		return gamelogic.ColorBlue
+	case "red":
+		return gamelogic.ColorRed
+	}
+	return gamelogic.ColorBlue
+}
+
+// ColorToString returns the color as used in state attributes ("RED"),
+// welcome messages use the lower case form.
+func ColorToString(c gamelogic.Color) string {
+	if c == gamelogic.ColorRed {
+		return "RED"
+	}
+	return "BLUE"
+}
+
+func StringToDirection(s string) (gamelogic.Direction, bool) {
+	for _, d := range gamelogic.Directions() {
+		if d.String() == s {
+			return d, true
+		}
+	}
+	return gamelogic.DirectionUp, false
+}
+
+// NewGameState converts a received state, it fails if the board is not
+// completely described by the state. The board size is taken from the number
+// of columns, all other rules are assumed to be the official ones.
+func NewGameState(state *StateMessage) (*gamelogic.GameState, error) {
+	size := len(state.Board.Fields)
+	if size == 0 || size > gamelogic.MaxBoardSize {
+		return nil, fmt.Errorf("unsupported board size %d", size)
+	}
+	fields := make([][]*gamelogic.Field, size)
+	for i := 0; i < len(fields); i++ {
+		fields[i] = make([]*gamelogic.Field, size)
+	}
+
+	for _, f := range state.Board.Fields {
+
+		for _, field := range f.Fields {
+			if field.X < 0 || field.X >= size || field.Y < 0 || field.Y >= size {
+				return nil, fmt.Errorf("field (%d, %d) is not on the board", field.X, field.Y)
+			}
+			fields[field.Y][field.X] = &gamelogic.Field{X: field.X, Y: field.Y, T: StringToFieldType(field.FieldState)}
+		}
+	}
+	for y := range fields {
+		for x := range fields[y] {
+			if fields[y][x] == nil {
+				return nil, fmt.Errorf("field (%d, %d) is missing", x, y)
+			}
+		}
+	}
+
+	board := gamelogic.NewBoard(fields, size, size)
+
+	gameState := gamelogic.NewGameState(board)
+	gameState.Turn = state.Turn
+	gameState.StartColor = StringToColor(state.StartPlayerColor)
+	gameState.CurrentColor = StringToColor(state.CurrentPlayerColor)
+	if state.LastMove != nil {
+		if d, ok := StringToDirection(state.LastMove.Direction); ok {
+			gameState.LastMove = gamelogic.NewMove(state.LastMove.X, state.LastMove.Y, d)
+		}
+	}
+	return gameState, nil
+}
+
+func NewStateMessage(state *gamelogic.GameState, redName string, blueName string) StateMessage {
+	board := state.Board()
+	msg := StateMessage{
+		RedPlayer:          PlayerMessage{DisplayName: redName, Color: "RED"},
+		BluePlayer:         PlayerMessage{DisplayName: blueName, Color: "BLUE"},
+		StartPlayerColor:   ColorToString(state.StartColor),
+		CurrentPlayerColor: ColorToString(state.CurrentColor),
+		Turn:               state.Turn,
+	}
+	for x := 0; x < board.Width(); x++ {
+		var column FieldsMessage
+		for y := 0; y < board.Height(); y++ {
+			field := board.GetField(x, y)
+			column.Fields = append(column.Fields, FieldMessage{FieldState: FieldTypeToString(field.T), X: x, Y: y})
+		}
+		msg.Board.Fields = append(msg.Board.Fields, column)
+	}
+	if state.LastMove != nil {
+		msg.LastMove = &MoveMessage{X: state.LastMove.X, Y: state.LastMove.Y, Direction: state.LastMove.Direction.String()}
+	}
+	return msg
+}
@@ -0,0 +1,245 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+const (
+	ClassMemento     = "memento"
+	ClassWelcome     = "welcomeMessage"
+	ClassMoveRequest = "sc.framework.plugins.protocol.MoveRequest"
+	ClassResult      = "result"
+)
+
+// Message is one message received from the server. Name is the element name
+// (joined, left, error, observed, prepared or data), data messages carry
+// their class and the decoded content of known classes.
+type Message struct {
+	Name     string
+	Class    string
+	RoomID   string
+	Attrs    map[string]string
+	Memento  *MementoMessage
+	Welcome  *WelcomeMessage
+	Result   *ResultMessage
+	Prepared *PreparedMessage
+}
+
+// DecodeError describes a message which could not be decoded. Unless it is
+// fatal the decoder skipped the broken message and decoding can continue.
+type DecodeError struct {
+	Err   error
+	Fatal bool
+}
+
+func (e *DecodeError) Error() string {
+	return e.Err.Error()
+}
+
+// Decoder reads server messages from a stream. Messages may arrive in
+// arbitrary fragments, whitespace between messages is ignored and after a
+// malformed message the decoder resynchronizes on the next top level
+// element.
+type Decoder struct {
+	source *errorTracker
+	r      *bufio.Reader
+	d      *xml.Decoder
+	roomID string
+	Debugf func(format string, v ...interface{})
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	source := &errorTracker{r: r}
+	br := bufio.NewReader(source)
+	// the xml decoder reads byte by byte from a io.ByteReader, so after a
+	// syntax error br is positioned right behind the broken input
+	return &Decoder{source: source, r: br, d: xml.NewDecoder(br), Debugf: func(string, ...interface{}) {}}
+}
+
+// Next returns the next message. At the end of the protocol it returns
+// io.EOF, all other errors are of type *DecodeError.
+func (d *Decoder) Next() (*Message, error) {
+	for {
+		v, err := d.d.Token()
+		if err != nil {
+			return nil, d.recover(err)
+		}
+
+		switch t := v.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "protocol":
+			case "room":
+				d.roomID = attr(t, "roomId")
+			case "data":
+				msg, err := d.decodeData(t)
+				if err != nil || msg != nil {
+					return msg, err
+				}
+			case "joined", "left", "error", "observed":
+				msg := d.newMessage(t)
+				if err := d.d.Skip(); err != nil {
+					return nil, d.recover(err)
+				}
+				return msg, nil
+			case "prepared":
+				msg := d.newMessage(t)
+				msg.Prepared = new(PreparedMessage)
+				if err := d.d.DecodeElement(msg.Prepared, &t); err != nil {
+					return nil, d.recover(err)
+				}
+				return msg, nil
+			default:
+				d.Debugf("ignoring unknown element %s", t.Name.Local)
+				if err := d.d.Skip(); err != nil {
+					return nil, d.recover(err)
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "room":
+				d.roomID = ""
+			case "protocol":
+				return nil, io.EOF
+			}
+		}
+	}
+}
+
+func (d *Decoder) newMessage(t xml.StartElement) *Message {
+	msg := &Message{Name: t.Name.Local, RoomID: d.roomID, Attrs: make(map[string]string)}
+	for _, a := range t.Attr {
+		msg.Attrs[a.Name.Local] = a.Value
+	}
+	if roomID, ok := msg.Attrs["roomId"]; ok {
+		msg.RoomID = roomID
+	}
+	return msg
+}
+
+// decodeData decodes a data element of a known class, unknown classes are
+// skipped and yield no message.
+func (d *Decoder) decodeData(t xml.StartElement) (*Message, error) {
+	msg := d.newMessage(t)
+	msg.Class = msg.Attrs["class"]
+
+	var err error
+	switch msg.Class {
+	case ClassMemento:
+		msg.Memento = new(MementoMessage)
+		err = d.d.DecodeElement(msg.Memento, &t)
+	case ClassWelcome:
+		msg.Welcome = new(WelcomeMessage)
+		err = d.d.DecodeElement(msg.Welcome, &t)
+	case ClassResult:
+		msg.Result = new(ResultMessage)
+		err = d.d.DecodeElement(msg.Result, &t)
+	case ClassMoveRequest:
+		err = d.d.Skip()
+	default:
+		d.Debugf("ignoring data of unknown class %s", msg.Class)
+		if err := d.d.Skip(); err != nil {
+			return nil, d.recover(err)
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, d.recover(fmt.Errorf("could not decode %s: %v", msg.Class, err))
+	}
+	return msg, nil
+}
+
+// frameStarts are the top level elements the decoder resynchronizes on.
+var frameStarts = [][]byte{[]byte("room"), []byte("joined"), []byte("left"), []byte("error"), []byte("observed"), []byte("prepared"), []byte("/protocol")}
+
+// recover turns err into a DecodeError. Broken input is skipped up to the
+// next top level element, only a closed or failing stream is fatal.
+func (d *Decoder) recover(err error) error {
+	if d.source.err != nil && d.r.Buffered() == 0 {
+		if d.source.err == io.EOF {
+			return &DecodeError{Err: fmt.Errorf("connection closed before the end of the protocol"), Fatal: true}
+		}
+		return &DecodeError{Err: d.source.err, Fatal: true}
+	}
+
+	for {
+		b, readErr := d.r.ReadByte()
+		if readErr != nil {
+			return &DecodeError{Err: err, Fatal: true}
+		}
+		if b != '<' {
+			continue
+		}
+		for _, start := range frameStarts {
+			// the name has to be followed by a delimiter, <roomX is no
+			// room element
+			peek, _ := d.r.Peek(len(start) + 1)
+			if len(peek) > len(start) && bytes.Equal(peek[:len(start)], start) && isNameEnd(peek[len(start)]) {
+				// restart inside a synthetic protocol element so the
+				// closing </protocol> still matches
+				d.d = xml.NewDecoder(&prefixReader{prefix: []byte("<protocol><"), r: d.r})
+				d.roomID = ""
+				return &DecodeError{Err: err}
+			}
+		}
+	}
+}
+
+func isNameEnd(b byte) bool {
+	switch b {
+	case ' ', '\t', '\r', '\n', '>', '/':
+		return true
+	}
+	return false
+}
+
+// errorTracker remembers the last error of the underlying stream, so read
+// failures can be told apart from malformed input.
+type errorTracker struct {
+	r   io.Reader
+	err error
+}
+
+func (t *errorTracker) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if err != nil {
+		t.err = err
+	}
+	return n, err
+}
+
+type prefixReader struct {
+	prefix []byte
+	r      *bufio.Reader
+}
+
+func (p *prefixReader) ReadByte() (byte, error) {
+	if len(p.prefix) > 0 {
+		b := p.prefix[0]
+		p.prefix = p.prefix[1:]
+		return b, nil
+	}
+	return p.r.ReadByte()
+}
+
+func (p *prefixReader) Read(b []byte) (int, error) {
+	if len(p.prefix) > 0 {
+		n := copy(b, p.prefix)
+		p.prefix = p.prefix[n:]
+		return n, nil
+	}
+	return p.r.Read(b)
+}
+
+func attr(t xml.StartElement, name string) string {
+	for _, a := range t.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,167 @@
+package protocol
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// chunkReader returns its data in reads of at most size bytes and fails with
+// err once the data is exhausted.
+type chunkReader struct {
+	data string
+	size int
+	err  error
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := r.size
+	if n > len(p) {
+		n = len(p)
+	}
+	if n > len(r.data) {
+		n = len(r.data)
+	}
+	copy(p, r.data[:n])
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// decodeAll decodes messages until the end of the protocol or a fatal error
+// and describes every result in one line.
+func decodeAll(t *testing.T, r io.Reader) []string {
+	var events []string
+	d := NewDecoder(r)
+	for len(events) < 100 {
+		msg, err := d.Next()
+		if err == io.EOF {
+			return append(events, "EOF")
+		}
+		if err != nil {
+			decodeErr, ok := err.(*DecodeError)
+			if !ok {
+				t.Fatalf("unexpected error type %T: %v", err, err)
+			}
+			if decodeErr.Fatal {
+				return append(events, "fatal")
+			}
+			events = append(events, "error")
+			continue
+		}
+		if msg.Name == "data" {
+			events = append(events, "data "+msg.Class+" "+msg.RoomID)
+		} else {
+			events = append(events, msg.Name+" "+msg.RoomID)
+		}
+	}
+	t.Fatalf("decoder does not end: %v", events)
+	return nil
+}
+
+const (
+	joinedFrame  = `<joined roomId="r1"/>`
+	welcomeFrame = `<room roomId="r1"><data class="welcomeMessage" color="red"/></room>`
+	requestFrame = `<room roomId="r1"><data class="sc.framework.plugins.protocol.MoveRequest"/></room>`
+	resultFrame  = `<room roomId="r1"><data class="result"><score cause="REGULAR" reason=""><part>2</part><part>8</part></score><winner displayName="a" color="RED"/></data></room>`
+)
+
+func TestDecoder(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		err    error
+		events []string
+	}{
+		{
+			name:   "frames",
+			input:  "<protocol>" + joinedFrame + welcomeFrame + requestFrame + resultFrame + "</protocol>",
+			events: []string{"joined r1", "data welcomeMessage r1", "data " + ClassMoveRequest + " r1", "data result r1", "EOF"},
+		},
+		{
+			name:   "keep-alive whitespace",
+			input:  "<protocol>\n  " + joinedFrame + "\n\n" + welcomeFrame + " \t\r\n " + requestFrame + "\n</protocol>\n",
+			events: []string{"joined r1", "data welcomeMessage r1", "data " + ClassMoveRequest + " r1", "EOF"},
+		},
+		{
+			name:   "unknown class",
+			input:  `<protocol><room roomId="r1"><data class="sc.plugin2019.Unknown"><nested a="1"><deeper/></nested></data></room>` + welcomeFrame + "</protocol>",
+			events: []string{"data welcomeMessage r1", "EOF"},
+		},
+		{
+			name:   "unknown element",
+			input:  `<protocol><sc.protocol.responses.Unknown a="1"><x/></sc.protocol.responses.Unknown>` + joinedFrame + "</protocol>",
+			events: []string{"joined r1", "EOF"},
+		},
+		{
+			name:   "malformed frame is skipped",
+			input:  `<protocol><room roomId="r1"><data class="welcomeMessage" color="red"></room>` + joinedFrame + welcomeFrame + "</protocol>",
+			events: []string{"error", "joined r1", "data welcomeMessage r1", "EOF"},
+		},
+		{
+			name:   "invalid content of a known class",
+			input:  `<protocol><room roomId="r1"><data class="result"><score><part>2</score></data></room>` + requestFrame + "</protocol>",
+			events: []string{"error", "data " + ClassMoveRequest + " r1", "EOF"},
+		},
+		{
+			name:   "no resync on a longer element name",
+			input:  `<protocol><room roomId="r1"><data class="welcomeMessage"></room><roomX><</roomX>` + joinedFrame + "</protocol>",
+			events: []string{"error", "joined r1", "EOF"},
+		},
+		{
+			name:   "stream closed in a frame",
+			input:  "<protocol>" + joinedFrame + `<room roomId="r1"><data class="welcomeMessage"`,
+			err:    io.EOF,
+			events: []string{"joined r1", "fatal"},
+		},
+		{
+			name:   "stream closed before the end of the protocol",
+			input:  "<protocol>" + joinedFrame,
+			err:    io.EOF,
+			events: []string{"joined r1", "fatal"},
+		},
+		{
+			name:   "read error",
+			input:  "<protocol>" + welcomeFrame,
+			err:    errors.New("connection reset"),
+			events: []string{"data welcomeMessage r1", "fatal"},
+		},
+	}
+
+	for _, test := range tests {
+		err := test.err
+		if err == nil {
+			err = io.EOF
+		}
+		// the frames must be decoded the same however the input is split
+		for _, size := range []int{1, 2, 7, 64, len(test.input)} {
+			events := decodeAll(t, &chunkReader{data: test.input, size: size, err: err})
+			if !reflect.DeepEqual(events, test.events) {
+				t.Errorf("%s, reads of %d bytes: got %s, expected %s", test.name, size, strings.Join(events, ", "), strings.Join(test.events, ", "))
+			}
+		}
+	}
+}
+
+func TestDecoderMessageContent(t *testing.T) {
+	d := NewDecoder(strings.NewReader("<protocol>" + welcomeFrame + resultFrame + "</protocol>"))
+	msg, err := d.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Welcome == nil || msg.Welcome.Color != "red" {
+		t.Errorf("welcome message decoded as %+v", msg.Welcome)
+	}
+	msg, err = d.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := msg.Result
+	if result == nil || len(result.Scores) != 1 || !reflect.DeepEqual(result.Scores[0].Parts, []string{"2", "8"}) || result.Winner == nil || result.Winner.Color != "RED" {
+		t.Errorf("result message decoded as %+v", result)
+	}
+}
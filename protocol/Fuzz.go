@@ -0,0 +1,43 @@
+// +build gofuzz
+
+package protocol
+
+import (
+	"bytes"
+	"io"
+)
+
+// Fuzz feeds arbitrary server traffic into the decoder, run it with go-fuzz.
+// The decoder must neither panic nor hang and must end with io.EOF or a
+// fatal error.
+func Fuzz(data []byte) int {
+	d := NewDecoder(bytes.NewReader(data))
+	messages := 0
+	for i := 0; ; i++ {
+		if i > len(data)+1 {
+			panic("decoder does not consume its input")
+		}
+		msg, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			decodeErr, ok := err.(*DecodeError)
+			if !ok {
+				panic("unexpected error type: " + err.Error())
+			}
+			if decodeErr.Fatal {
+				break
+			}
+			continue
+		}
+		if msg.Memento != nil {
+			NewGameState(&msg.Memento.State)
+		}
+		messages++
+	}
+	if messages > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,168 @@
+package protocol
+
+import "encoding/xml"
+
+const GameType = "swc_2019_piranhas"
+
+type Room struct {
+	Id string `xml:"roomId"`
+}
+
+type Joined struct {
+	Id string `xml:"roomId"`
+}
+
+type WelcomeMessage struct {
+	Color string `xml:"color,attr"`
+}
+
+type MementoMessage struct {
+	State StateMessage `xml:"state"`
+}
+
+type PlayerMessage struct {
+	DisplayName string `xml:"displayName,attr"`
+	Color       string `xml:"color,attr"`
+}
+
+type StateMessage struct {
+	Class              string        `xml:"class,attr,omitempty"`
+	RedPlayer          PlayerMessage `xml:"red"`
+	BluePlayer         PlayerMessage `xml:"blue"`
+	Board              BoardMessage  `xml:"board"`
+	StartPlayerColor   string        `xml:"startPlayerColor,attr"`
+	CurrentPlayerColor string        `xml:"currentPlayerColor,attr"`
+	Turn               int           `xml:"turn,attr"`
+	LastMove           *MoveMessage  `xml:"lastMove"`
+}
+
+type MoveMessage struct {
+	X         int    `xml:"x,attr"`
+	Y         int    `xml:"y,attr"`
+	Direction string `xml:"direction,attr"`
+}
+
+type FieldMessage struct {
+	FieldState string `xml:"state,attr"`
+	X          int    `xml:"x,attr"`
+	Y          int    `xml:"y,attr"`
+}
+
+type FieldsMessage struct {
+	Fields []FieldMessage `xml:"field"`
+}
+
+type BoardMessage struct {
+	Fields []FieldsMessage `xml:"fields"`
+}
+
+type ScoreMessage struct {
+	Cause  string   `xml:"cause,attr"`
+	Reason string   `xml:"reason,attr"`
+	Parts  []string `xml:"part"`
+}
+
+type FragmentMessage struct {
+	Name               string `xml:"name,attr"`
+	Aggregation        string `xml:"aggregation"`
+	RelevantForRanking bool   `xml:"relevantForRanking"`
+}
+
+type DefinitionMessage struct {
+	Fragments []FragmentMessage `xml:"fragment"`
+}
+
+type ResultMessage struct {
+	Definition DefinitionMessage `xml:"definition"`
+	Scores     []ScoreMessage    `xml:"score"`
+	Winner     *PlayerMessage    `xml:"winner"`
+}
+
+type ErrorMessage struct {
+	XMLName xml.Name `xml:"error"`
+	Message string   `xml:"message,attr"`
+}
+
+type SlotMessage struct {
+	DisplayName    string `xml:"displayName,attr"`
+	CanTimeout     bool   `xml:"canTimeout,attr"`
+	ShouldBePaused bool   `xml:"shouldBePaused,attr"`
+}
+
+type PrepareMessage struct {
+	XMLName  xml.Name      `xml:"prepare"`
+	GameType string        `xml:"gameType,attr"`
+	Slots    []SlotMessage `xml:"slot"`
+}
+
+type PreparedMessage struct {
+	XMLName      xml.Name `xml:"prepared"`
+	RoomID       string   `xml:"roomId,attr"`
+	Reservations []string `xml:"reservation"`
+}
+
+// RoomData wraps a data element of the given class into a room message,
+// which is how every game message is framed on the wire.
+type RoomData struct {
+	XMLName xml.Name `xml:"room"`
+	RoomID  string   `xml:"roomId,attr"`
+	Data    interface{}
+}
+
+type MementoData struct {
+	XMLName xml.Name     `xml:"data"`
+	Class   string       `xml:"class,attr"`
+	State   StateMessage `xml:"state"`
+}
+
+type WelcomeData struct {
+	XMLName xml.Name `xml:"data"`
+	Class   string   `xml:"class,attr"`
+	Color   string   `xml:"color,attr"`
+}
+
+type MoveRequestData struct {
+	XMLName xml.Name `xml:"data"`
+	Class   string   `xml:"class,attr"`
+}
+
+type MoveData struct {
+	XMLName   xml.Name `xml:"data"`
+	Class     string   `xml:"class,attr"`
+	X         int      `xml:"x,attr"`
+	Y         int      `xml:"y,attr"`
+	Direction string   `xml:"direction,attr"`
+}
+
+type ResultData struct {
+	XMLName    xml.Name          `xml:"data"`
+	Class      string            `xml:"class,attr"`
+	Definition DefinitionMessage `xml:"definition"`
+	Scores     []ScoreMessage    `xml:"score"`
+	Winner     *PlayerMessage    `xml:"winner"`
+}
+
+func NewMementoData(state StateMessage) *MementoData {
+	state.Class = "state"
+	return &MementoData{Class: "memento", State: state}
+}
+
+func NewWelcomeData(color string) *WelcomeData {
+	return &WelcomeData{Class: "welcomeMessage", Color: color}
+}
+
+func NewMoveRequestData() *MoveRequestData {
+	return &MoveRequestData{Class: "sc.framework.plugins.protocol.MoveRequest"}
+}
+
+func NewMoveData(x int, y int, direction string) *MoveData {
+	return &MoveData{Class: "move", X: x, Y: y, Direction: direction}
+}
+
+func NewResultData(scores []ScoreMessage, winner *PlayerMessage) *ResultData {
+	definition := DefinitionMessage{Fragments: []FragmentMessage{
+		{Name: "Gewinner", Aggregation: "SUM", RelevantForRanking: true},
+		{Name: "Durchschnittliche Größe des größten Schwarms", Aggregation: "AVERAGE", RelevantForRanking: true},
+	}}
+	return &ResultData{Class: "result", Definition: definition, Scores: scores, Winner: winner}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"PWBSS2019/gamelogic"
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+func printPosition(w io.Writer, state *gamelogic.GameState) {
+	fmt.Fprintf(w, "turn %d, %s to move\n", state.Turn, colorName(state.CurrentColor))
+	if state.LastMove != nil {
+		fmt.Fprintf(w, "last move: %s\n", state.LastMove.String())
+	}
+	fmt.Fprint(w, state.Board())
+}
+
+// evaluatePosition runs the engine on state from the view of the player to
+// move and returns its best move and heuristic.
+func evaluatePosition(controller *gamelogic.Controller, state *gamelogic.GameState, moveTime time.Duration) (*gamelogic.Move, float64, error) {
+	controller.UpdateState(state)
+	controller.SetPlayer(state.CurrentColor)
+	ctx, cancel := context.WithTimeout(context.Background(), moveTime)
+	defer cancel()
+	return controller.Evaluate(ctx)
+}
+
+// printEndgame reports the forced outcome found by the last evaluation.
+func printEndgame(w io.Writer, controller *gamelogic.Controller, state *gamelogic.GameState) {
+	if endgame := controller.Endgame(); endgame.Outcome != gamelogic.OutcomeUnknown {
+		fmt.Fprintf(w, "forced %s for %s in %d plies\n", endgame.Outcome, colorName(state.CurrentColor), endgame.Distance)
+	}
+}
+
+func colorName(c gamelogic.Color) string {
+	if c == gamelogic.ColorRed {
+		return "red"
+	}
+	return "blue"
+}
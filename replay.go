@@ -0,0 +1,58 @@
+package main
+
+import (
+	"PWBSS2019/gamelogic"
+	"PWBSS2019/replay"
+	"bufio"
+	"fmt"
+	"github.com/pborman/getopt"
+	"os"
+	"time"
+)
+
+func replayMain(args []string) error {
+	set := getopt.New()
+	interactive := set.BoolLong("interactive", 'i', "wait for enter after every ply")
+	moveTime := set.DurationLong("move-time", 0, 500*time.Millisecond, "time budget for evaluating a position")
+	set.SetParameters("replay-file")
+	set.Parse(args)
+	if set.NArgs() != 1 {
+		set.PrintUsage(os.Stderr)
+		return errUsage
+	}
+
+	r, err := replay.Load(set.Arg(0))
+	if err != nil {
+		return fmt.Errorf("could not load replay: %v", err)
+	}
+
+	input := bufio.NewReader(os.Stdin)
+	controller := gamelogic.NewController(gamelogic.DefaultTranspositionMemory)
+	for i, state := range r.States {
+		printPosition(os.Stdout, state)
+
+		move, heuristic, err := evaluatePosition(controller, state, *moveTime)
+		if err != nil {
+			fmt.Printf("evaluation: %v\n", err)
+		} else {
+			fmt.Printf("evaluation: %.2f, best move %s", heuristic, move.String())
+			if i < len(r.Moves) && r.Moves[i] != nil {
+				fmt.Printf(", played %s", r.Moves[i].String())
+			}
+			fmt.Println()
+			printEndgame(os.Stdout, controller, state)
+		}
+		fmt.Println()
+
+		if *interactive {
+			input.ReadString('\n')
+		}
+	}
+
+	if r.Result != nil && r.Result.Winner != nil {
+		fmt.Printf("winner: %s (%s)\n", r.Result.Winner.DisplayName, r.Result.Winner.Color)
+	} else if r.Result != nil {
+		fmt.Println("draw")
+	}
+	return nil
+}
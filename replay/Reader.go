@@ -0,0 +1,134 @@
+package replay
+
+import (
+	"PWBSS2019/gamelogic"
+	"PWBSS2019/protocol"
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Replay is the sequence of game states of one game. Moves[i] leads from
+// States[i] to States[i+1].
+type Replay struct {
+	RoomID string
+	States []*gamelogic.GameState
+	Moves  []*gamelogic.Move
+	Result *protocol.ResultMessage
+}
+
+// Load reads a replay file as written by the official server or by this
+// client, gzip compressed files are detected automatically.
+func Load(path string) (*Replay, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Read(file)
+}
+
+func Read(r io.Reader) (*Replay, error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		return decode(gz)
+	}
+	return decode(buffered)
+}
+
+// decode collects the mementos of the replay. Official replays contain the
+// states either wrapped in room/data elements like on the wire or as bare
+// state elements.
+func decode(r io.Reader) (*Replay, error) {
+	replay := &Replay{}
+	d := xml.NewDecoder(r)
+	for {
+		v, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read replay: %v", err)
+		}
+
+		t, ok := v.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch t.Name.Local {
+		case "room":
+			if replay.RoomID == "" {
+				replay.RoomID = attr(t, "roomId")
+			}
+		case "data":
+			switch attr(t, "class") {
+			case "memento":
+				data := new(protocol.MementoMessage)
+				if err := d.DecodeElement(data, &t); err != nil {
+					return nil, fmt.Errorf("could not decode memento: %v", err)
+				}
+				if err := replay.add(&data.State); err != nil {
+					return nil, err
+				}
+			case "result":
+				data := new(protocol.ResultMessage)
+				if err := d.DecodeElement(data, &t); err != nil {
+					return nil, fmt.Errorf("could not decode result: %v", err)
+				}
+				replay.Result = data
+			default:
+				if err := d.Skip(); err != nil {
+					return nil, err
+				}
+			}
+		case "state":
+			data := new(protocol.StateMessage)
+			if err := d.DecodeElement(data, &t); err != nil {
+				return nil, fmt.Errorf("could not decode state: %v", err)
+			}
+			if err := replay.add(data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(replay.States) == 0 {
+		return nil, fmt.Errorf("replay contains no game states")
+	}
+	return replay, nil
+}
+
+func (r *Replay) add(msg *protocol.StateMessage) error {
+	state, err := protocol.NewGameState(msg)
+	if err != nil {
+		return fmt.Errorf("invalid state of turn %d: %v", msg.Turn, err)
+	}
+	if len(r.States) > 0 {
+		last := r.States[len(r.States)-1]
+		if state.Turn == last.Turn {
+			// repeated states, e.g. the final state sent again with the result
+			return nil
+		}
+		r.Moves = append(r.Moves, state.LastMove)
+	}
+	r.States = append(r.States, state)
+	return nil
+}
+
+func attr(t xml.StartElement, name string) string {
+	for _, a := range t.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,95 @@
+package replay
+
+import (
+	"PWBSS2019/protocol"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Writer records the messages of one game in the framing used on the wire,
+// which is the format of the official replay files.
+type Writer struct {
+	w       io.Writer
+	roomID  string
+	closers []io.Closer
+}
+
+func NewWriter(w io.Writer, roomID string) (*Writer, error) {
+	writer := &Writer{w: w, roomID: roomID}
+	if _, err := io.WriteString(w, "<protocol>\n"); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// Create creates the replay file name.xml in dir, or name.xml.gz if compress
+// is set. Existing files are never overwritten, a counter is appended to the
+// name instead.
+func Create(dir string, name string, roomID string, compress bool) (*Writer, error) {
+	extension := ".xml"
+	if compress {
+		extension += ".gz"
+	}
+	path := filepath.Join(dir, name+extension)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	for i := 1; os.IsExist(err); i++ {
+		path = filepath.Join(dir, fmt.Sprintf("%s-%d%s", name, i, extension))
+		file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var w io.Writer = file
+	closers := []io.Closer{file}
+	if compress {
+		gz := gzip.NewWriter(file)
+		w = gz
+		closers = []io.Closer{gz, file}
+	}
+
+	writer, err := NewWriter(w, roomID)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	writer.closers = closers
+	return writer, nil
+}
+
+func (w *Writer) Write(data interface{}) error {
+	out, err := xml.Marshal(&protocol.RoomData{RoomID: w.roomID, Data: data})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w.w, "%s\n", out)
+	return err
+}
+
+func (w *Writer) WriteMemento(state protocol.StateMessage) error {
+	return w.Write(protocol.NewMementoData(state))
+}
+
+func (w *Writer) WriteMove(x int, y int, direction string) error {
+	return w.Write(protocol.NewMoveData(x, y, direction))
+}
+
+func (w *Writer) WriteResult(result *protocol.ResultMessage) error {
+	return w.Write(protocol.NewResultData(result.Scores, result.Winner))
+}
+
+// Close ends the protocol element and closes the underlying file if the
+// writer was created with Create.
+func (w *Writer) Close() error {
+	_, err := io.WriteString(w.w, "</protocol>\n")
+	for _, c := range w.closers {
+		if closeErr := c.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
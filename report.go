@@ -0,0 +1,34 @@
+package main
+
+import (
+	"PWBSS2019/gamelogic"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// reportLog appends the move reports of all games as JSON lines to a file,
+// it is shared by the clients of parallel games.
+type reportLog struct {
+	lock    sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func openReportLog(path string) (*reportLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &reportLog{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (l *reportLog) write(report gamelogic.MoveReport) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.encoder.Encode(report)
+}
+
+func (l *reportLog) close() error {
+	return l.file.Close()
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"PWBSS2019/gamelogic"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// writeSearchTree writes the tree of the last search as DOT and JSON file
+// named after the room and turn into dir.
+func writeSearchTree(dir string, controller *gamelogic.Controller) error {
+	tree := controller.SearchTree()
+	state := controller.State()
+	if tree == nil || state == nil {
+		return nil
+	}
+	name := filepath.Join(dir, fmt.Sprintf("%s-turn%02d", controller.RoomID(), state.Turn))
+	if err := writeFile(name+".dot", func(w io.Writer) error { return gamelogic.WriteDOT(w, tree) }); err != nil {
+		return err
+	}
+	return writeFile(name+".json", func(w io.Writer) error { return gamelogic.WriteTreeJSON(w, tree) })
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"PWBSS2019/gamelogic"
+	"PWBSS2019/server"
+	"fmt"
+	"github.com/pborman/getopt"
+	"net"
+	"os"
+	"strconv"
+)
+
+func serverMain(args []string) error {
+	set := getopt.New()
+	port := set.IntLong("port", 'p', 13050, "port to listen on")
+	password := set.StringLong("password", 'a', "", "administrator password for preparing games")
+	softTimeout := set.DurationLong("soft-timeout", 's', server.DefaultSoftTimeout, "time after which a move loses the game")
+	hardTimeout := set.DurationLong("hard-timeout", 'H', server.DefaultHardTimeout, "time after which a player is disconnected")
+	replayDir := set.StringLong("replays", 'r', "", "directory to record game replays into")
+	rules := gamelogic.DefaultRules()
+	size := set.IntLong("size", 0, rules.Size, "width and height of the board")
+	turnLimit := set.IntLong("turn-limit", 0, rules.TurnLimit, "number of turns after which the larger swarm wins")
+	obstacles := set.IntLong("obstacles", 0, rules.Obstacles, "number of obstructed fields")
+	adjacency := set.StringLong("adjacency", 0, rules.Adjacency.String(), "which piranhas form a swarm: diagonal or orthogonal")
+	set.Parse(args)
+
+	rules.Size = *size
+	rules.TurnLimit = *turnLimit
+	rules.Obstacles = *obstacles
+	var err error
+	if rules.Adjacency, err = gamelogic.ParseAdjacency(*adjacency); err != nil {
+		return err
+	}
+	if err := rules.Validate(); err != nil {
+		return fmt.Errorf("invalid rules: %v", err)
+	}
+
+	s := server.NewServer()
+	s.Password = *password
+	s.SoftTimeout = *softTimeout
+	s.HardTimeout = *hardTimeout
+	s.Rules = rules
+	if *replayDir != "" {
+		if err := os.MkdirAll(*replayDir, 0755); err != nil {
+			return fmt.Errorf("could not create replay directory: %v", err)
+		}
+		s.ReplayDir = *replayDir
+	}
+
+	l, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(*port)))
+	if err != nil {
+		return fmt.Errorf("could not listen on port %d: %v", *port, err)
+	}
+	fmt.Printf("server listening on port %d\n", *port)
+	return fmt.Errorf("server stopped: %v", s.Serve(l))
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"PWBSS2019/protocol"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+type clientMessage struct {
+	Name     string
+	RoomID   string
+	Attrs    map[string]string
+	Children []*clientMessage
+}
+
+func (m *clientMessage) Attr(name string) string {
+	return m.Attrs[name]
+}
+
+type client struct {
+	conn        net.Conn
+	displayName string
+	messages    chan *clientMessage
+	closed      chan struct{}
+	err         error
+	writeLock   sync.Mutex
+}
+
+func newClient(conn net.Conn) *client {
+	c := &client{conn: conn, messages: make(chan *clientMessage, 16), closed: make(chan struct{})}
+	go c.read()
+	return c
+}
+
+// read decodes the client stream and forwards every relevant element to the
+// messages channel, which is closed as soon as the stream ends. Closed is
+// closed at the same time, it lets others wait for the end of the stream
+// without taking messages away from the game.
+func (c *client) read() {
+	defer close(c.closed)
+	defer close(c.messages)
+	d := xml.NewDecoder(c.conn)
+	roomID := ""
+	for {
+		v, err := d.Token()
+		if err != nil {
+			if err != io.EOF {
+				c.err = err
+			}
+			return
+		}
+
+		switch t := v.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "protocol":
+			case "room":
+				roomID = attr(t, "roomId")
+			default:
+				msg, err := readMessage(d, t)
+				if err != nil {
+					c.err = err
+					return
+				}
+				msg.RoomID = roomID
+				c.messages <- msg
+			}
+		case xml.EndElement:
+			if t.Name.Local == "room" {
+				roomID = ""
+			}
+		}
+	}
+}
+
+func readMessage(d *xml.Decoder, start xml.StartElement) (*clientMessage, error) {
+	msg := &clientMessage{Name: start.Name.Local, Attrs: make(map[string]string)}
+	for _, a := range start.Attr {
+		msg.Attrs[a.Name.Local] = a.Value
+	}
+	for {
+		v, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := v.(type) {
+		case xml.StartElement:
+			child, err := readMessage(d, t)
+			if err != nil {
+				return nil, err
+			}
+			msg.Children = append(msg.Children, child)
+		case xml.EndElement:
+			return msg, nil
+		}
+	}
+}
+
+func (c *client) sendRaw(s string) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	_, err := io.WriteString(c.conn, s)
+	return err
+}
+
+// holdWrites blocks all sends to c until the returned function was called,
+// so the string passed to it is the next message c receives.
+func (c *client) holdWrites() func(string) error {
+	c.writeLock.Lock()
+	return func(s string) error {
+		defer c.writeLock.Unlock()
+		_, err := io.WriteString(c.conn, s)
+		return err
+	}
+}
+
+func (c *client) send(v interface{}) error {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.sendRaw(string(data))
+}
+
+func (c *client) sendRoom(roomID string, data interface{}) error {
+	return c.send(&protocol.RoomData{RoomID: roomID, Data: data})
+}
+
+func (c *client) close() {
+	c.sendRaw("</protocol>")
+	c.conn.Close()
+}
+
+func (c *client) String() string {
+	return fmt.Sprintf("%s (%s)", c.displayName, c.conn.RemoteAddr())
+}
+
+func attr(t xml.StartElement, name string) string {
+	for _, a := range t.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
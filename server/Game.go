@@ -0,0 +1,317 @@
+package server
+
+import (
+	"PWBSS2019/gamelogic"
+	"PWBSS2019/protocol"
+	"PWBSS2019/replay"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	CauseRegular       = "REGULAR"
+	CauseLeft          = "LEFT"
+	CauseRuleViolation = "RULE_VIOLATION"
+	CauseSoftTimeout   = "SOFT_TIMEOUT"
+	CauseHardTimeout   = "HARD_TIMEOUT"
+	CauseUnknown       = "UNKNOWN"
+	pointsWin          = 2
+	pointsDraw         = 1
+	pointsLoss         = 0
+)
+
+type Result struct {
+	RoomID     string
+	Draw       bool
+	Winner     gamelogic.Color
+	Cause      string
+	Reason     string
+	Turn       int
+	SwarmSizes [2]int
+}
+
+type game struct {
+	roomID      string
+	clients     [2]*client
+	players     [2]*gamelogic.Player
+	state       *gamelogic.GameState
+	moveLogic   *gamelogic.MoveLogic
+	softTimeout time.Duration
+	hardTimeout time.Duration
+	canTimeout  [2]bool
+	replay      *replay.Writer
+	observers   []*client
+	lock        sync.Mutex
+}
+
+func newGame(roomID string, red *client, blue *client, r *rand.Rand, rules gamelogic.Rules) *game {
+	g := &game{roomID: roomID, moveLogic: gamelogic.NewMoveLogic(rules)}
+	g.clients[gamelogic.ColorRed] = red
+	g.clients[gamelogic.ColorBlue] = blue
+	g.players[gamelogic.ColorRed] = gamelogic.NewPlayer(gamelogic.ColorRed)
+	g.players[gamelogic.ColorBlue] = gamelogic.NewPlayer(gamelogic.ColorBlue)
+	g.state = gamelogic.NewGameState(gamelogic.NewStartBoard(r, rules))
+	g.state.Rules = rules
+	g.state.StartColor = gamelogic.ColorRed
+	g.state.CurrentColor = gamelogic.ColorRed
+	g.canTimeout = [2]bool{true, true}
+	return g
+}
+
+func (g *game) recordReplay(dir string) error {
+	w, err := replay.Create(dir, g.roomID, g.roomID, false)
+	if err != nil {
+		return err
+	}
+	g.replay = w
+	return nil
+}
+
+func (g *game) writeReplay(data interface{}) {
+	if g.replay == nil {
+		return
+	}
+	if err := g.replay.Write(data); err != nil {
+		log.Printf("room %s: could not write replay: %v", g.roomID, err)
+	}
+}
+
+// addObserver sends the current memento of a running game to c and adds it
+// to the observers. Nothing is sent while holding the lock, if a move was
+// made in the meantime the newer memento is sent before c is added, so c
+// never sees an outdated position last.
+func (g *game) addObserver(c *client) {
+	var sent *gamelogic.GameState
+	for {
+		g.lock.Lock()
+		if g.state == sent || g.state.Turn == 0 {
+			g.observers = append(g.observers, c)
+			g.lock.Unlock()
+			return
+		}
+		state := g.state
+		memento := g.memento()
+		g.lock.Unlock()
+
+		if err := c.sendRoom(g.roomID, memento); err != nil {
+			log.Printf("room %s: observer %s left: %v", g.roomID, c, err)
+			c.conn.Close()
+			return
+		}
+		sent = state
+	}
+}
+
+func (g *game) broadcast(data interface{}) {
+	g.writeReplay(data)
+	for _, c := range g.clients {
+		if err := c.sendRoom(g.roomID, data); err != nil {
+			log.Printf("room %s: could not send to %s: %v", g.roomID, c, err)
+		}
+	}
+
+	g.lock.Lock()
+	observers := append([]*client(nil), g.observers...)
+	g.lock.Unlock()
+	var left []*client
+	for _, c := range observers {
+		if err := c.sendRoom(g.roomID, data); err != nil {
+			log.Printf("room %s: observer %s left: %v", g.roomID, c, err)
+			c.conn.Close()
+			left = append(left, c)
+		}
+	}
+	if len(left) > 0 {
+		g.removeObservers(left)
+	}
+}
+
+func (g *game) removeObservers(left []*client) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	observers := g.observers[:0]
+	for _, c := range g.observers {
+		if !containsClient(left, c) {
+			observers = append(observers, c)
+		}
+	}
+	g.observers = observers
+}
+
+func containsClient(clients []*client, c *client) bool {
+	for _, other := range clients {
+		if other == c {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *game) memento() *protocol.MementoData {
+	return protocol.NewMementoData(protocol.NewStateMessage(g.state, g.clients[gamelogic.ColorRed].displayName, g.clients[gamelogic.ColorBlue].displayName))
+}
+
+func (g *game) play() *Result {
+	for i, c := range g.clients {
+		c.sendRoom(g.roomID, protocol.NewWelcomeData(colorName(gamelogic.Color(i))))
+	}
+
+	for {
+		g.broadcast(g.memento())
+		if result := g.checkEnd(); result != nil {
+			return result
+		}
+
+		color := g.state.CurrentColor
+		current := g.clients[color]
+		if err := current.sendRoom(g.roomID, protocol.NewMoveRequestData()); err != nil {
+			return g.lose(color, CauseLeft, err.Error())
+		}
+
+		move, result := g.awaitMove(color)
+		if result != nil {
+			return result
+		}
+
+		if err := g.validateMove(color, move); err != nil {
+			return g.lose(color, CauseRuleViolation, err.Error())
+		}
+		g.applyMove(move)
+	}
+}
+
+// awaitMove waits for the move of the given player. A move arriving after
+// the soft timeout loses the game, after the hard timeout the player is
+// disconnected without waiting any longer.
+func (g *game) awaitMove(color gamelogic.Color) (*gamelogic.Move, *Result) {
+	current := g.clients[color]
+	start := time.Now()
+	var hardTimeout <-chan time.Time
+	if g.canTimeout[color] && g.hardTimeout > 0 {
+		timer := time.NewTimer(g.hardTimeout)
+		defer timer.Stop()
+		hardTimeout = timer.C
+	}
+
+	for {
+		select {
+		case msg, ok := <-current.messages:
+			if !ok {
+				return nil, g.lose(color, CauseLeft, "player left the game")
+			}
+			if msg.Name != "data" || msg.Attr("class") != "move" {
+				continue
+			}
+			if elapsed := time.Since(start); g.canTimeout[color] && g.softTimeout > 0 && elapsed > g.softTimeout {
+				return nil, g.lose(color, CauseSoftTimeout, fmt.Sprintf("move took %v", elapsed))
+			}
+			move, err := parseMove(msg)
+			if err != nil {
+				return nil, g.lose(color, CauseRuleViolation, err.Error())
+			}
+			return move, nil
+		case <-hardTimeout:
+			return nil, g.lose(color, CauseHardTimeout, fmt.Sprintf("no move within %v", g.hardTimeout))
+		}
+	}
+}
+
+func parseMove(msg *clientMessage) (*gamelogic.Move, error) {
+	var x, y int
+	if _, err := fmt.Sscan(msg.Attr("x"), &x); err != nil {
+		return nil, fmt.Errorf("invalid x coordinate %q", msg.Attr("x"))
+	}
+	if _, err := fmt.Sscan(msg.Attr("y"), &y); err != nil {
+		return nil, fmt.Errorf("invalid y coordinate %q", msg.Attr("y"))
+	}
+	direction, ok := protocol.StringToDirection(msg.Attr("direction"))
+	if !ok {
+		return nil, fmt.Errorf("invalid direction %q", msg.Attr("direction"))
+	}
+	return gamelogic.NewMove(x, y, direction), nil
+}
+
+func (g *game) validateMove(color gamelogic.Color, move *gamelogic.Move) error {
+	return g.moveLogic.ValidateMove(g.state.Board(), g.players[color], move)
+}
+
+func (g *game) applyMove(move *gamelogic.Move) {
+	next := g.moveLogic.NextState(g.state, move)
+	g.lock.Lock()
+	g.state = next
+	g.lock.Unlock()
+}
+
+// checkEnd finishes the game once the rules decide it.
+func (g *game) checkEnd() *Result {
+	over, draw, winner := g.moveLogic.GameOver(g.state)
+	if !over {
+		return nil
+	}
+	result := g.newResult(CauseRegular, "")
+	result.Draw = draw
+	result.Winner = winner
+	return g.finish(result)
+}
+
+func (g *game) lose(color gamelogic.Color, cause string, reason string) *Result {
+	log.Printf("room %s: %s loses: %s (%s)", g.roomID, g.clients[color], cause, reason)
+	result := g.newResult(cause, reason)
+	result.Winner = color.OppositeColor()
+	return g.finish(result)
+}
+
+func (g *game) newResult(cause string, reason string) *Result {
+	result := &Result{RoomID: g.roomID, Cause: cause, Reason: reason, Turn: g.state.Turn}
+	for i, p := range g.players {
+		result.SwarmSizes[i] = g.moveLogic.CalculateSwarmSize(g.state.Board(), p)
+	}
+	return result
+}
+
+func (g *game) finish(result *Result) *Result {
+	var scores []protocol.ScoreMessage
+	var winner *protocol.PlayerMessage
+	// scores are sent in the order red, blue
+	for _, color := range []gamelogic.Color{gamelogic.ColorRed, gamelogic.ColorBlue} {
+		score := protocol.ScoreMessage{Cause: CauseRegular, Parts: []string{fmt.Sprint(pointsLoss), fmt.Sprint(result.SwarmSizes[color])}}
+		if result.Draw {
+			score.Parts[0] = fmt.Sprint(pointsDraw)
+		} else if result.Winner == color {
+			score.Parts[0] = fmt.Sprint(pointsWin)
+		} else {
+			score.Cause = result.Cause
+			score.Reason = result.Reason
+		}
+		scores = append(scores, score)
+	}
+	if !result.Draw {
+		winner = &protocol.PlayerMessage{DisplayName: g.clients[result.Winner].displayName, Color: protocol.ColorToString(result.Winner)}
+	}
+
+	g.broadcast(protocol.NewResultData(scores, winner))
+	g.lock.Lock()
+	clients := append(g.clients[:], g.observers...)
+	g.observers = nil
+	g.lock.Unlock()
+	for _, c := range clients {
+		c.sendRaw(fmt.Sprintf("<left roomId=\"%s\"/>", g.roomID))
+		c.close()
+	}
+	if g.replay != nil {
+		if err := g.replay.Close(); err != nil {
+			log.Printf("room %s: could not write replay: %v", g.roomID, err)
+		}
+	}
+	return result
+}
+
+func colorName(c gamelogic.Color) string {
+	if c == gamelogic.ColorRed {
+		return "red"
+	}
+	return "blue"
+}
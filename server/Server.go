@@ -0,0 +1,417 @@
+package server
+
+import (
+	"PWBSS2019/gamelogic"
+	"PWBSS2019/protocol"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultSoftTimeout = 2 * time.Second
+	DefaultHardTimeout = 10 * time.Second
+)
+
+// Server is a local stand-in for the official Java game server. It speaks
+// the 2019 Piranhas protocol and checks every move with gamelogic.
+type Server struct {
+	Rand         *rand.Rand
+	Password     string
+	SoftTimeout  time.Duration
+	HardTimeout  time.Duration
+	ReplayDir    string
+	Rules        gamelogic.Rules
+	Results      chan *Result
+	lock         sync.Mutex
+	waiting      *preparedGame
+	reservations map[string]*preparedGame
+	prepared     map[string]*preparedGame
+	games        map[string]*game
+}
+
+type preparedGame struct {
+	roomID     string
+	codes      [2]string
+	names      [2]string
+	canTimeout [2]bool
+	clients    [2]*client
+	observers  []*client
+	// started is closed once both slots are taken and the game was created
+	started chan struct{}
+}
+
+func NewServer() *Server {
+	return &Server{
+		Rand:         rand.New(rand.NewSource(time.Now().UnixNano())),
+		SoftTimeout:  DefaultSoftTimeout,
+		HardTimeout:  DefaultHardTimeout,
+		Rules:        gamelogic.DefaultRules(),
+		reservations: make(map[string]*preparedGame),
+		prepared:     make(map[string]*preparedGame),
+		games:        make(map[string]*game),
+	}
+}
+
+// PlayGame accepts the next two clients on l, lets them join and plays a
+// single game between them. The first client to join plays red.
+func (s *Server) PlayGame(l net.Listener) (*Result, error) {
+	var clients []*client
+	for len(clients) < 2 {
+		conn, err := l.Accept()
+		if err != nil {
+			for _, c := range clients {
+				c.close()
+			}
+			return nil, err
+		}
+		c := newClient(conn)
+		c.sendRaw("<protocol>")
+		if err := s.awaitJoin(c); err != nil {
+			c.close()
+			continue
+		}
+		clients = append(clients, c)
+	}
+
+	roomID := s.newRoomID()
+	for _, c := range clients {
+		c.sendRaw(fmt.Sprintf("<joined roomId=\"%s\"/>", roomID))
+	}
+	s.lock.Lock()
+	g := s.newGame(roomID, clients[0], clients[1])
+	s.lock.Unlock()
+	return g.play(), nil
+}
+
+func (s *Server) awaitJoin(c *client) error {
+	msg, ok := <-c.messages
+	if !ok {
+		return fmt.Errorf("client %s left before joining", c)
+	}
+	if msg.Name != "join" || msg.Attr("gameType") != protocol.GameType {
+		return fmt.Errorf("client %s sent unexpected %s instead of join", c, msg.Name)
+	}
+	c.displayName = c.conn.RemoteAddr().String()
+	return nil
+}
+
+// Serve accepts clients on l until the listener is closed. Clients sending
+// join are paired in the order they arrive, clients sending joinPrepared are
+// placed into the game their reservation code belongs to.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(newClient(conn))
+	}
+}
+
+func (s *Server) handle(c *client) {
+	c.sendRaw("<protocol>")
+	authenticated := false
+	for msg := range c.messages {
+		switch msg.Name {
+		case "join":
+			if msg.Attr("gameType") != protocol.GameType {
+				s.sendError(c, fmt.Sprintf("unknown game type %q", msg.Attr("gameType")))
+				continue
+			}
+			s.join(c)
+			return
+		case "joinRoom":
+			if err := s.joinRoom(c, msg.Attr("roomId")); err != nil {
+				s.sendError(c, err.Error())
+				continue
+			}
+			return
+		case "joinPrepared":
+			if err := s.joinPrepared(c, msg.Attr("reservationCode")); err != nil {
+				s.sendError(c, err.Error())
+				continue
+			}
+			return
+		case "authenticate":
+			authenticated = s.Password != "" && msg.Attr("passphrase") == s.Password
+			if !authenticated {
+				s.sendError(c, "authentication failed")
+			}
+		case "prepare":
+			if !authenticated {
+				s.sendError(c, "prepare requires authentication")
+				continue
+			}
+			s.prepare(c, msg)
+		case "observe":
+			if !authenticated {
+				s.sendError(c, "observe requires authentication")
+				continue
+			}
+			if err := s.observe(c, msg.Attr("roomId")); err != nil {
+				s.sendError(c, err.Error())
+				continue
+			}
+			return
+		default:
+			log.Printf("client %s sent unexpected %s", c, msg.Name)
+		}
+	}
+	c.conn.Close()
+}
+
+func (s *Server) sendError(c *client, message string) {
+	log.Printf("client %s: %s", c, message)
+	c.send(&protocol.ErrorMessage{Message: message})
+}
+
+// join places c into the room waiting for an opponent or opens a new room
+// if there is none.
+func (s *Server) join(c *client) {
+	c.displayName = c.conn.RemoteAddr().String()
+	roomID := s.newRoomID()
+
+	s.lock.Lock()
+	var a *admission
+	if s.waiting != nil {
+		// the client waiting first may have left again
+		slot := 1
+		if s.waiting.clients[0] == nil {
+			slot = 0
+		}
+		a = s.enter(s.waiting, slot, c)
+	} else {
+		s.waiting = &preparedGame{roomID: roomID, canTimeout: [2]bool{true, true}, started: make(chan struct{})}
+		s.prepared[roomID] = s.waiting
+		a = s.enter(s.waiting, 0, c)
+	}
+	s.lock.Unlock()
+	s.admit(a)
+}
+
+func (s *Server) joinPrepared(c *client, code string) error {
+	s.lock.Lock()
+	prepared, ok := s.reservations[code]
+	if !ok {
+		s.lock.Unlock()
+		return fmt.Errorf("unknown reservation code %q", code)
+	}
+	slot := 0
+	if prepared.codes[1] == code {
+		slot = 1
+	}
+	c.displayName = prepared.names[slot]
+	a := s.enter(prepared, slot, c)
+	s.lock.Unlock()
+	s.admit(a)
+	return nil
+}
+
+// joinRoom places c into the first free slot of an existing room. Slots
+// reserved for a reservation code are never free.
+func (s *Server) joinRoom(c *client, roomID string) error {
+	s.lock.Lock()
+	prepared, ok := s.prepared[roomID]
+	if !ok {
+		s.lock.Unlock()
+		return fmt.Errorf("room %q does not exist", roomID)
+	}
+	slot := -1
+	for i := range prepared.clients {
+		if prepared.clients[i] == nil && prepared.codes[i] == "" {
+			slot = i
+			break
+		}
+	}
+	if slot < 0 {
+		s.lock.Unlock()
+		return fmt.Errorf("room %q has no free slot", roomID)
+	}
+	c.displayName = prepared.names[slot]
+	if c.displayName == "" {
+		c.displayName = c.conn.RemoteAddr().String()
+	}
+	a := s.enter(prepared, slot, c)
+	s.lock.Unlock()
+	s.admit(a)
+	return nil
+}
+
+// admission is what is left to do after a client entered a room, it is done
+// by admit once the server lock is released.
+type admission struct {
+	roomID    string
+	joined    func(string) error
+	game      *game
+	observers []*client
+	prepared  *preparedGame
+	slot      int
+	client    *client
+}
+
+// enter puts c into the given slot and creates the game once both slots are
+// taken. The caller must hold the server lock and pass the result to admit
+// after releasing it. Until then no other message can be sent to c.
+func (s *Server) enter(prepared *preparedGame, slot int, c *client) *admission {
+	delete(s.reservations, prepared.codes[slot])
+	prepared.clients[slot] = c
+	a := &admission{roomID: prepared.roomID, joined: c.holdWrites(), prepared: prepared, slot: slot, client: c}
+	if prepared.clients[0] == nil || prepared.clients[1] == nil {
+		return a
+	}
+
+	delete(s.prepared, prepared.roomID)
+	if s.waiting == prepared {
+		s.waiting = nil
+	}
+	close(prepared.started)
+	a.game = s.newGame(prepared.roomID, prepared.clients[0], prepared.clients[1])
+	a.game.canTimeout = prepared.canTimeout
+	a.observers = prepared.observers
+	s.games[a.game.roomID] = a.game
+	return a
+}
+
+// admit confirms the join and starts the game if the room is complete,
+// otherwise it waits until the opponent arrives.
+func (s *Server) admit(a *admission) {
+	a.joined(fmt.Sprintf("<joined roomId=\"%s\"/>", a.roomID))
+	if a.game == nil {
+		s.awaitOpponent(a.prepared, a.slot, a.client)
+		return
+	}
+	for _, observer := range a.observers {
+		a.game.addObserver(observer)
+	}
+	go s.run(a.game)
+}
+
+// awaitOpponent blocks until the game of the room starts. If c leaves
+// before, its slot is freed again, and a reserved slot can be joined with
+// the same reservation code once more.
+func (s *Server) awaitOpponent(prepared *preparedGame, slot int, c *client) {
+	select {
+	case <-prepared.started:
+		return
+	case <-c.closed:
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if prepared.clients[slot] != c || s.prepared[prepared.roomID] != prepared {
+		return
+	}
+	prepared.clients[slot] = nil
+	if code := prepared.codes[slot]; code != "" {
+		s.reservations[code] = prepared
+	}
+	log.Printf("room %s: client %s left before the game started", prepared.roomID, c)
+	c.conn.Close()
+}
+
+// prepare reserves a room for two slots and answers with one reservation
+// code per slot, the first slot plays red.
+func (s *Server) prepare(c *client, msg *clientMessage) {
+	if msg.Attr("gameType") != protocol.GameType {
+		s.sendError(c, fmt.Sprintf("unknown game type %q", msg.Attr("gameType")))
+		return
+	}
+	prepared := &preparedGame{roomID: s.newRoomID(), started: make(chan struct{})}
+	for i := range prepared.codes {
+		prepared.codes[i] = s.newRoomID()
+		prepared.names[i] = fmt.Sprintf("Player %d", i+1)
+		prepared.canTimeout[i] = true
+	}
+	slots := 0
+	for _, child := range msg.Children {
+		if child.Name != "slot" || slots >= 2 {
+			continue
+		}
+		if name := child.Attr("displayName"); name != "" {
+			prepared.names[slots] = name
+		}
+		prepared.canTimeout[slots] = child.Attr("canTimeout") != "false"
+		slots++
+	}
+
+	s.lock.Lock()
+	for _, code := range prepared.codes {
+		s.reservations[code] = prepared
+	}
+	s.prepared[prepared.roomID] = prepared
+	s.lock.Unlock()
+
+	c.send(&protocol.PreparedMessage{RoomID: prepared.roomID, Reservations: prepared.codes[:]})
+}
+
+// observe registers c as observer of a running or prepared game, it
+// receives every memento and the result of the game. The confirmation is
+// sent before c is registered, so it always precedes the first memento.
+func (s *Server) observe(c *client, roomID string) error {
+	if !s.roomExists(roomID) {
+		return fmt.Errorf("room %q does not exist", roomID)
+	}
+	c.sendRaw(fmt.Sprintf("<observed roomId=\"%s\"/>", roomID))
+
+	s.lock.Lock()
+	if prepared, ok := s.prepared[roomID]; ok {
+		prepared.observers = append(prepared.observers, c)
+		s.lock.Unlock()
+		return nil
+	}
+	g, ok := s.games[roomID]
+	s.lock.Unlock()
+	if !ok {
+		return fmt.Errorf("the game in room %q is over", roomID)
+	}
+	g.addObserver(c)
+	return nil
+}
+
+func (s *Server) roomExists(roomID string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, running := s.games[roomID]
+	_, prepared := s.prepared[roomID]
+	return running || prepared
+}
+
+// newGame creates the game for the given room, the caller must hold the
+// server lock.
+func (s *Server) newGame(roomID string, red *client, blue *client) *game {
+	g := newGame(roomID, red, blue, rand.New(rand.NewSource(s.Rand.Int63())), s.Rules)
+	g.softTimeout = s.SoftTimeout
+	g.hardTimeout = s.HardTimeout
+	if s.ReplayDir != "" {
+		if err := g.recordReplay(s.ReplayDir); err != nil {
+			log.Printf("room %s: could not record replay: %v", roomID, err)
+		}
+	}
+	return g
+}
+
+func (s *Server) run(g *game) {
+	result := g.play()
+	s.lock.Lock()
+	delete(s.games, g.roomID)
+	s.lock.Unlock()
+
+	if result.Draw {
+		log.Printf("room %s: draw after turn %d", result.RoomID, result.Turn)
+	} else {
+		log.Printf("room %s: %s wins after turn %d (%s)", result.RoomID, g.clients[result.Winner].displayName, result.Turn, result.Cause)
+	}
+	if s.Results != nil {
+		s.Results <- result
+	}
+}
+
+func (s *Server) newRoomID() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return fmt.Sprintf("%08x-%04x", s.Rand.Uint32(), s.Rand.Intn(0x10000))
+}
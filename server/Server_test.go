@@ -0,0 +1,509 @@
+package server
+
+import (
+	"PWBSS2019/gamelogic"
+	"PWBSS2019/protocol"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+)
+
+// testPlayer joins a game on the server and always plays the first legal
+// move.
+type testPlayer struct {
+	// join is the element sent to join, a plain join if it is empty
+	join string
+	// delay is waited before every move, with a negative delay the player
+	// never moves
+	delay time.Duration
+	// joined receives the room id once the player joined, if it is set
+	joined chan string
+}
+
+// played is what a test player saw of a game.
+type played struct {
+	color  gamelogic.Color
+	result *protocol.ResultMessage
+	err    error
+}
+
+// play connects to the server and plays until the server closes the
+// connection.
+func (p *testPlayer) play(address string) played {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return played{err: err}
+	}
+	defer conn.Close()
+	join := p.join
+	if join == "" {
+		join = "<join gameType=\"" + protocol.GameType + "\"/>"
+	}
+	if _, err := io.WriteString(conn, "<protocol>"+join); err != nil {
+		return played{err: err}
+	}
+
+	moveLogic := &gamelogic.MoveLogic{}
+	var color gamelogic.Color
+	var player *gamelogic.Player
+	var state *gamelogic.GameState
+	var result *protocol.ResultMessage
+	d := protocol.NewDecoder(conn)
+	for {
+		msg, err := d.Next()
+		if err == io.EOF {
+			if player == nil {
+				return played{err: fmt.Errorf("connection closed before welcome")}
+			}
+			return played{color: color, result: result}
+		}
+		if err != nil {
+			return played{err: err}
+		}
+		switch msg.Name {
+		case "joined":
+			if p.joined != nil {
+				p.joined <- msg.Attrs["roomId"]
+			}
+			continue
+		case "error":
+			return played{err: fmt.Errorf("server sent error: %s", msg.Attrs["message"])}
+		case "data":
+		default:
+			continue
+		}
+		switch msg.Class {
+		case protocol.ClassWelcome:
+			color = protocol.StringToColor(msg.Welcome.Color)
+			player = gamelogic.NewPlayer(color)
+		case protocol.ClassMemento:
+			if state, err = protocol.NewGameState(&msg.Memento.State); err != nil {
+				return played{err: err}
+			}
+		case protocol.ClassMoveRequest:
+			if player == nil || state == nil {
+				return played{err: fmt.Errorf("move request before welcome and memento")}
+			}
+			if p.delay < 0 {
+				continue
+			}
+			time.Sleep(p.delay)
+			moves := moveLogic.GetPossibleMoves(state.Board(), player)
+			if len(moves) == 0 {
+				return played{err: fmt.Errorf("no legal move in turn %d", state.Turn)}
+			}
+			move := moves[0]
+			_, err := io.WriteString(conn, fmt.Sprintf("<room roomId=\"%s\"><data class=\"move\" x=\"%d\" y=\"%d\" direction=\"%s\"/></room>", msg.RoomID, move.X, move.Y, move.Direction))
+			if err != nil {
+				return played{err: err}
+			}
+		case protocol.ClassResult:
+			result = msg.Result
+		}
+	}
+}
+
+// playAll lets the players play concurrently and returns what they saw in
+// the order of the players.
+func playAll(address string, players ...*testPlayer) []played {
+	results := make([]chan played, len(players))
+	for i, p := range players {
+		results[i] = make(chan played, 1)
+		go func(p *testPlayer, result chan played) { result <- p.play(address) }(p, results[i])
+	}
+	var all []played
+	for _, result := range results {
+		all = append(all, <-result)
+	}
+	return all
+}
+
+const testPassword = "secret"
+
+// serve starts a server with a fixed seed on a local port. The returned
+// function stops accepting clients.
+func serve(t *testing.T) (*Server, string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer()
+	s.Rand = rand.New(rand.NewSource(1))
+	s.Password = testPassword
+	s.Results = make(chan *Result, 4)
+	go s.Serve(l)
+	return s, l.Addr().String(), func() { l.Close() }
+}
+
+// administrate connects to the server and authenticates.
+func administrate(t *testing.T, address string) (net.Conn, *protocol.Decoder) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(conn, "<protocol><authenticate passphrase=\""+testPassword+"\"/>"); err != nil {
+		t.Fatal(err)
+	}
+	return conn, protocol.NewDecoder(conn)
+}
+
+// prepareGame reserves a game for the given slots.
+func prepareGame(t *testing.T, conn net.Conn, d *protocol.Decoder, slots ...protocol.SlotMessage) *protocol.PreparedMessage {
+	data, err := xml.Marshal(&protocol.PrepareMessage{GameType: protocol.GameType, Slots: slots})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	msg := nextMessage(t, d, "prepared")
+	return msg.Prepared
+}
+
+// nextMessage skips everything up to the next message with the given name.
+func nextMessage(t *testing.T, d *protocol.Decoder, name string) *protocol.Message {
+	for {
+		msg, err := d.Next()
+		if err != nil {
+			t.Fatalf("waiting for %s: %v", name, err)
+		}
+		if msg.Name == name {
+			return msg
+		}
+		if msg.Name == "error" {
+			t.Fatalf("waiting for %s: server sent error: %s", name, msg.Attrs["message"])
+		}
+	}
+}
+
+// expectError sends request on a new connection and checks that the server
+// answers with an error.
+func expectError(t *testing.T, address string, request string) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, "<protocol>"+request); err != nil {
+		t.Fatal(err)
+	}
+	d := protocol.NewDecoder(conn)
+	for {
+		msg, err := d.Next()
+		if err != nil {
+			t.Fatalf("%s: no error before %v", request, err)
+		}
+		switch msg.Name {
+		case "error":
+			return
+		case "joined", "observed", "prepared":
+			t.Fatalf("%s: server answered %s instead of an error", request, msg.Name)
+		}
+	}
+}
+
+// awaitResult returns the next game result of the server.
+func awaitResult(t *testing.T, s *Server) *Result {
+	select {
+	case result := <-s.Results:
+		return result
+	case <-time.After(10 * time.Second):
+		t.Fatal("no game result")
+		return nil
+	}
+}
+
+// waitFor polls condition under the server lock until it holds.
+func waitFor(t *testing.T, s *Server, description string, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.lock.Lock()
+		ok := condition()
+		s.lock.Unlock()
+		if ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting until %s", description)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// checkPlayed checks that both players finished without error, saw the
+// result and played different colors.
+func checkPlayed(t *testing.T, all []played) {
+	for i, p := range all {
+		if p.err != nil {
+			t.Fatalf("player %d failed: %v", i, p.err)
+		}
+		if p.result == nil {
+			t.Fatalf("player %d did not receive a result", i)
+		}
+	}
+	if all[0].color == all[1].color {
+		t.Errorf("both players play %s", protocol.ColorToString(all[0].color))
+	}
+}
+
+func TestPlayGame(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s := NewServer()
+	s.Rand = rand.New(rand.NewSource(1))
+	players := make(chan played, 2)
+	for i := 0; i < 2; i++ {
+		go func() { players <- (&testPlayer{}).play(l.Addr().String()) }()
+	}
+
+	result, err := s.PlayGame(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Cause != CauseRegular {
+		t.Errorf("game ended with cause %s (%s), expected %s", result.Cause, result.Reason, CauseRegular)
+	}
+	if result.Turn == 0 {
+		t.Errorf("game ended without a move")
+	}
+
+	for i := 0; i < 2; i++ {
+		p := <-players
+		if p.err != nil {
+			t.Fatalf("player failed: %v", p.err)
+		}
+		if p.result == nil {
+			t.Fatalf("player did not receive a result")
+		}
+		if len(p.result.Scores) != 2 {
+			t.Fatalf("result has %d scores, expected 2", len(p.result.Scores))
+		}
+		if result.Draw && p.result.Winner != nil {
+			t.Errorf("draw announced with winner %s", p.result.Winner.Color)
+		}
+		if !result.Draw && (p.result.Winner == nil || protocol.StringToColor(p.result.Winner.Color) != result.Winner) {
+			t.Errorf("result message names winner %+v, expected %s", p.result.Winner, protocol.ColorToString(result.Winner))
+		}
+		// scores are sent in the order red, blue
+		for i, color := range []gamelogic.Color{gamelogic.ColorRed, gamelogic.ColorBlue} {
+			points := pointsLoss
+			if result.Draw {
+				points = pointsDraw
+			} else if color == result.Winner {
+				points = pointsWin
+			}
+			score := p.result.Scores[i]
+			if len(score.Parts) != 2 || score.Parts[0] != fmt.Sprint(points) || score.Parts[1] != fmt.Sprint(result.SwarmSizes[color]) {
+				t.Errorf("score of %s is %v, expected %d points and swarm size %d", protocol.ColorToString(color), score.Parts, points, result.SwarmSizes[color])
+			}
+		}
+	}
+}
+
+func TestJoinPrepared(t *testing.T) {
+	s, address, stop := serve(t)
+	defer stop()
+	conn, d := administrate(t, address)
+	defer conn.Close()
+	prepared := prepareGame(t, conn, d,
+		protocol.SlotMessage{DisplayName: "Alice", CanTimeout: true},
+		protocol.SlotMessage{DisplayName: "Bob", CanTimeout: true})
+	if len(prepared.Reservations) != 2 {
+		t.Fatalf("prepared %d reservations, expected 2", len(prepared.Reservations))
+	}
+	expectError(t, address, "<joinPrepared reservationCode=\"unknown\"/>")
+
+	// the second slot joins first, it still plays blue
+	blue := &testPlayer{join: "<joinPrepared reservationCode=\"" + prepared.Reservations[1] + "\"/>", joined: make(chan string, 1)}
+	red := &testPlayer{join: "<joinPrepared reservationCode=\"" + prepared.Reservations[0] + "\"/>"}
+	results := make(chan played, 1)
+	go func() { results <- blue.play(address) }()
+	if roomID := <-blue.joined; roomID != prepared.RoomID {
+		t.Errorf("joined room %s, expected %s", roomID, prepared.RoomID)
+	}
+	expectError(t, address, "<joinPrepared reservationCode=\""+prepared.Reservations[1]+"\"/>")
+	all := []played{red.play(address), <-results}
+	checkPlayed(t, all)
+	if all[0].color != gamelogic.ColorRed {
+		t.Errorf("first slot plays %s, expected red", protocol.ColorToString(all[0].color))
+	}
+
+	result := awaitResult(t, s)
+	if result.Cause != CauseRegular || result.RoomID != prepared.RoomID {
+		t.Errorf("game in room %s ended with cause %s, expected %s in room %s", result.RoomID, result.Cause, CauseRegular, prepared.RoomID)
+	}
+	if !result.Draw {
+		name := "Bob"
+		if result.Winner == gamelogic.ColorRed {
+			name = "Alice"
+		}
+		if winner := all[0].result.Winner; winner == nil || winner.DisplayName != name {
+			t.Errorf("result message names winner %+v, expected %s", winner, name)
+		}
+	}
+}
+
+func TestJoinRoom(t *testing.T) {
+	s, address, stop := serve(t)
+	defer stop()
+	conn, d := administrate(t, address)
+	defer conn.Close()
+	prepared := prepareGame(t, conn, d, protocol.SlotMessage{CanTimeout: true}, protocol.SlotMessage{CanTimeout: true})
+	expectError(t, address, "<joinRoom roomId=\""+prepared.RoomID+"\"/>")
+	expectError(t, address, "<joinRoom roomId=\"unknown\"/>")
+
+	first := &testPlayer{joined: make(chan string, 1)}
+	results := make(chan played, 1)
+	go func() { results <- first.play(address) }()
+	roomID := <-first.joined
+	second := &testPlayer{join: "<joinRoom roomId=\"" + roomID + "\"/>"}
+	secondPlayed := second.play(address)
+	all := []played{<-results, secondPlayed}
+	checkPlayed(t, all)
+
+	result := awaitResult(t, s)
+	if result.Cause != CauseRegular || result.RoomID != roomID {
+		t.Errorf("game in room %s ended with cause %s, expected %s in room %s", result.RoomID, result.Cause, CauseRegular, roomID)
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	tests := []struct {
+		name  string
+		soft  time.Duration
+		hard  time.Duration
+		delay time.Duration
+		cause string
+	}{
+		{name: "soft", soft: 50 * time.Millisecond, hard: 10 * time.Second, delay: 200 * time.Millisecond, cause: CauseSoftTimeout},
+		{name: "hard", soft: 50 * time.Millisecond, hard: 200 * time.Millisecond, delay: -1, cause: CauseHardTimeout},
+	}
+	for _, test := range tests {
+		s, address, stop := serve(t)
+		s.SoftTimeout = test.soft
+		s.HardTimeout = test.hard
+
+		// the player joining first plays red and moves first
+		slow := &testPlayer{delay: test.delay, joined: make(chan string, 1)}
+		results := make(chan played, 1)
+		go func() { results <- slow.play(address) }()
+		<-slow.joined
+		fast := (&testPlayer{}).play(address)
+		all := []played{<-results, fast}
+		stop()
+		checkPlayed(t, all)
+
+		result := awaitResult(t, s)
+		if result.Cause != test.cause || result.Winner != gamelogic.ColorBlue || result.Turn != 0 {
+			t.Errorf("%s: %s won with cause %s in turn %d, expected blue with cause %s in turn 0", test.name, protocol.ColorToString(result.Winner), result.Cause, result.Turn, test.cause)
+		}
+		if scores := all[0].result.Scores; len(scores) != 2 || scores[0].Cause != test.cause {
+			t.Errorf("%s: scores %+v do not name cause %s for red", test.name, scores, test.cause)
+		}
+	}
+}
+
+func TestObserve(t *testing.T) {
+	s, address, stop := serve(t)
+	defer stop()
+	expectError(t, address, "<observe roomId=\"unknown\"/>")
+	conn, d := administrate(t, address)
+	defer conn.Close()
+	expectError(t, address, "<observe roomId=\"unknown\"/>")
+	prepared := prepareGame(t, conn, d, protocol.SlotMessage{CanTimeout: true}, protocol.SlotMessage{CanTimeout: true})
+	if _, err := io.WriteString(conn, "<observe roomId=\""+prepared.RoomID+"\"/>"); err != nil {
+		t.Fatal(err)
+	}
+	if observed := nextMessage(t, d, "observed"); observed.Attrs["roomId"] != prepared.RoomID {
+		t.Errorf("observed room %s, expected %s", observed.Attrs["roomId"], prepared.RoomID)
+	}
+
+	var players []*testPlayer
+	for _, code := range prepared.Reservations {
+		players = append(players, &testPlayer{join: "<joinPrepared reservationCode=\"" + code + "\"/>"})
+	}
+	all := playAll(address, players...)
+	checkPlayed(t, all)
+	result := awaitResult(t, s)
+
+	mementos := 0
+	var last *protocol.MementoMessage
+	var observedResult *protocol.ResultMessage
+	for {
+		msg, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Name != "data" {
+			continue
+		}
+		switch msg.Class {
+		case protocol.ClassMemento:
+			mementos++
+			last = msg.Memento
+		case protocol.ClassResult:
+			observedResult = msg.Result
+		}
+	}
+	if mementos != result.Turn+1 {
+		t.Errorf("observer received %d mementos, expected %d", mementos, result.Turn+1)
+	}
+	if last == nil || last.State.Turn != result.Turn {
+		t.Errorf("observer did not receive the last memento of turn %d", result.Turn)
+	}
+	if observedResult == nil {
+		t.Errorf("observer did not receive the result")
+	}
+}
+
+// TestLeaveBeforeStart checks that a client leaving before its opponent
+// arrives frees the slot, so the next clients get a working game.
+func TestLeaveBeforeStart(t *testing.T) {
+	s, address, stop := serve(t)
+	defer stop()
+	conn, d := administrate(t, address)
+	defer conn.Close()
+	prepared := prepareGame(t, conn, d, protocol.SlotMessage{CanTimeout: true}, protocol.SlotMessage{CanTimeout: true})
+	waitingJoin := "<join gameType=\"" + protocol.GameType + "\"/>"
+	preparedJoin := "<joinPrepared reservationCode=\"" + prepared.Reservations[0] + "\"/>"
+
+	for _, join := range []string{waitingJoin, preparedJoin} {
+		left, err := net.Dial("tcp", address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(left, "<protocol>"+join); err != nil {
+			t.Fatal(err)
+		}
+		nextMessage(t, protocol.NewDecoder(left), "joined")
+		left.Close()
+	}
+	waitFor(t, s, "the waiting client was removed", func() bool {
+		return s.waiting != nil && s.waiting.clients[0] == nil
+	})
+	waitFor(t, s, "the reservation can be used again", func() bool {
+		return s.reservations[prepared.Reservations[0]] == s.prepared[prepared.RoomID]
+	})
+
+	for _, joins := range [][2]string{
+		{waitingJoin, waitingJoin},
+		{preparedJoin, "<joinPrepared reservationCode=\"" + prepared.Reservations[1] + "\"/>"},
+	} {
+		all := playAll(address, &testPlayer{join: joins[0]}, &testPlayer{join: joins[1]})
+		checkPlayed(t, all)
+		if result := awaitResult(t, s); result.Cause != CauseRegular {
+			t.Errorf("game in room %s ended with cause %s (%s), expected %s", result.RoomID, result.Cause, result.Reason, CauseRegular)
+		}
+	}
+}